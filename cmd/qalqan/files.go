@@ -0,0 +1,388 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func runEncrypt(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("encrypt", stderr)
+	var kf keyFlags
+	kf.register(fs, true)
+	to := fs.Int("to", 0, "recipient user number, 0 for all users")
+	keyType := fs.String("key", "session", "key type: session or circle")
+	modeName := fs.String("mode", qalqan.ModeCTR.String(), "mode: CTR writes the chunked format; OFB, ECB and CBC the single-imit one")
+	out := fs.String("o", "", "output file (default FILE.qlq)")
+	archive := fs.Bool("archive", false, "pack all files and directories into one encrypted archive")
+	dir := fs.String("dir", "", "encrypt every file to its own .qlq below `DIR`, keeping the tree")
+	force := fs.Bool("f", false, "overwrite the output file")
+	paths, err := parsePaths(fs, args)
+	if err != nil {
+		return err
+	}
+	mode, err := qalqan.ParseMode(strings.ToUpper(*modeName))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	kt, ok := map[string]byte{"session": qalqan.KeyTypeSession, "circle": qalqan.KeyTypeCircle}[*keyType]
+	if !ok {
+		return fmt.Errorf("%w: unknown key type %q", errUsage, *keyType)
+	}
+	if *archive && *dir != "" {
+		return fmt.Errorf("%w: -archive and -dir exclude each other", errUsage)
+	}
+	if (*archive || *dir != "") && mode != qalqan.ModeCTR {
+		return fmt.Errorf("%w: archives and folders are encrypted in CTR mode only", errUsage)
+	}
+
+	var files []qalqan.ArchiveFile
+	if *archive || *dir != "" {
+		if files, err = qalqan.CollectArchiveFiles(paths...); err != nil {
+			return err
+		}
+	} else if len(paths) != 1 {
+		return fmt.Errorf("%w: use -archive or -dir to encrypt several files", errUsage)
+	}
+	if *out == "" {
+		abs, err := filepath.Abs(paths[0])
+		if err != nil {
+			return err
+		}
+		*out = abs + ".qlq"
+	}
+
+	keys, err := kf.load()
+	if err != nil {
+		return err
+	}
+	defer keys.Wipe()
+	if *to < 0 || *to > keys.Users() {
+		return fmt.Errorf("%w: recipient %d, key set has %d users", errUsage, *to, keys.Users())
+	}
+	imitKey, err := keys.ImitKey()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *dir != "":
+		n := 0
+		for _, f := range files {
+			if f.Dir {
+				continue
+			}
+			target := filepath.Join(*dir, filepath.FromSlash(f.Name)) + ".qlq"
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			h, fileKey, err := keys.NewFileHeader(kt, *to)
+			if err != nil {
+				return err
+			}
+			h.Mode = mode
+			h.FileType = qalqan.FileTypeFor(f.Name)
+			h.Name = filepath.Base(f.Path)
+			h.Size = f.Size
+			if err := encryptFile(keys, h, imitKey, fileKey, f.Path, target, *force); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s -> %s\n", f.Path, target)
+			n++
+		}
+		fmt.Fprintf(stdout, "%d files encrypted\n", n)
+		return nil
+	case *archive:
+		h, fileKey, err := keys.NewFileHeader(kt, *to)
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.Base(strings.TrimSuffix(*out, ".qlq"))
+		err = writeOutput(*out, *force, func(w io.Writer) error {
+			return qalqan.EncryptArchive(w, h, imitKey, fileKey, files)
+		})
+		if err != nil {
+			return err
+		}
+		if err := commitKey(keys, h); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d entries -> %s\n", len(files), *out)
+		return nil
+	}
+
+	path := paths[0]
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a regular file; use -archive or -dir", errUsage, path)
+	}
+	h, fileKey, err := keys.NewFileHeader(kt, *to)
+	if err != nil {
+		return err
+	}
+	h.Mode = mode
+	h.FileType = qalqan.FileTypeFor(path)
+	h.Name = filepath.Base(path)
+	h.Size = uint64(info.Size())
+	if err := encryptFile(keys, h, imitKey, fileKey, path, *out, *force); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s -> %s\n", path, *out)
+	return nil
+}
+
+// encryptFile encrypts path to out as described by h and records the use
+// of a session key.
+func encryptFile(keys *qalqan.KeyStore, h *qalqan.FileHeader, imitKey, fileKey cipher.Block, path, out string, force bool) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	writeFile := qalqan.WriteChunkedFile
+	if h.Mode != qalqan.ModeCTR {
+		writeFile = qalqan.WriteFile
+	}
+	err = writeOutput(out, force, func(w io.Writer) error {
+		return writeFile(w, h, imitKey, fileKey, src)
+	})
+	if err != nil {
+		return err
+	}
+	return commitKey(keys, h)
+}
+
+func commitKey(keys *qalqan.KeyStore, h *qalqan.FileHeader) error {
+	if h.KeyType != qalqan.KeyTypeSession {
+		return nil
+	}
+	if err := keys.CommitSessionKey(h.SessionKey); err != nil {
+		return fmt.Errorf("file encrypted, but the key usage ledger was not updated: %w", err)
+	}
+	return nil
+}
+
+func runDecrypt(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("decrypt", stderr)
+	var kf keyFlags
+	kf.register(fs, false)
+	out := fs.String("o", "", "output file, or directory for archives (default: the original name, next to FILE.qlq)")
+	force := fs.Bool("f", false, "overwrite the output file")
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	keys, err := kf.load()
+	if err != nil {
+		return err
+	}
+	defer keys.Wipe()
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	file, fileKey, err := openEncrypted(in, keys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Header.FileType == qalqan.FileTypeArchive {
+		return extractArchive(file, fileKey, path, *out, stdout)
+	}
+	plain, err := file.NewReader(fileKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if *out == "" {
+		*out = outputName(path, file.Header)
+	}
+	err = writeOutput(*out, *force, func(w io.Writer) error {
+		_, err := io.Copy(w, plain)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Fprintf(stdout, "%s -> %s (from user %d)\n", path, *out, file.Header.Sender)
+	return nil
+}
+
+// extractArchive restores the archive in file below dir, by default the
+// directory holding path.
+func extractArchive(file *qalqan.File, fileKey cipher.Block, path, dir string, stdout io.Writer) error {
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	ra, err := file.NewReaderAt(fileKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	a, err := qalqan.ReadArchive(ra, ra.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := a.Extract(dir); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Fprintf(stdout, "%s -> %s, %d entries (from user %d)\n", path, dir, len(a.Entries), file.Header.Sender)
+	return nil
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("verify", stderr)
+	var kf keyFlags
+	kf.register(fs, false)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	keys, err := kf.load()
+	if err != nil {
+		return err
+	}
+	defer keys.Wipe()
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	imitKey, err := keys.ImitKey()
+	if err != nil {
+		return err
+	}
+	h, err := qalqan.VerifyFile(in, info.Size(), imitKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if h.KeyLen != keys.KeyLen() {
+		return fmt.Errorf("%s: %w: file uses %d-byte keys, key set has %d", path, errWrongKey, h.KeyLen, keys.KeyLen())
+	}
+	fmt.Fprintf(stdout, "%s: OK\n", path)
+	fmt.Fprintf(stdout, "from:     user %d\n", h.Sender)
+	fmt.Fprintf(stdout, "key:      %s\n", h.KeyName())
+	fmt.Fprintf(stdout, "name:     %q\n", h.Name)
+	fmt.Fprintf(stdout, "size:     %d\n", h.Size)
+	return nil
+}
+
+func runInspect(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("inspect", stderr)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	h, err := qalqan.InspectFile(in, info.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	version := "legacy"
+	if h.Version != qalqan.ContainerLegacy {
+		version = strconv.Itoa(h.Version)
+	}
+	to := "all users"
+	if h.Recipient != 0 {
+		to = fmt.Sprintf("user %d", h.Recipient)
+	}
+	fmt.Fprintf(stdout, "version:  %s\n", version)
+	fmt.Fprintf(stdout, "mode:     %v\n", h.Mode)
+	if h.ChunkSize != 0 {
+		fmt.Fprintf(stdout, "chunks:   %d bytes\n", h.ChunkSize)
+	}
+	fmt.Fprintf(stdout, "key:      %s, %d bytes\n", h.KeyName(), h.KeyLen)
+	fmt.Fprintf(stdout, "from:     user %d\n", h.Sender)
+	fmt.Fprintf(stdout, "to:       %s\n", to)
+	fmt.Fprintf(stdout, "name:     %q\n", h.Name)
+	fmt.Fprintf(stdout, "size:     %d\n", h.Size)
+	fmt.Fprintln(stdout, "(not authenticated; use verify to check the imits)")
+	return nil
+}
+
+// openEncrypted authenticates in with the key set and returns it with the
+// key it was encrypted with.
+func openEncrypted(in *os.File, keys *qalqan.KeyStore) (*qalqan.File, cipher.Block, error) {
+	info, err := in.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	imitKey, err := keys.ImitKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := qalqan.OpenFile(in, info.Size(), imitKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := file.Header
+	if h.KeyLen != keys.KeyLen() {
+		return nil, nil, fmt.Errorf("%w: file uses %d-byte keys, key set has %d", errWrongKey, h.KeyLen, keys.KeyLen())
+	}
+	fileKey, err := keys.FileKey(h)
+	if errors.Is(err, qalqan.ErrUnknownKeyType) {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errWrongKey, err)
+	}
+	return file, fileKey, nil
+}
+
+// outputName returns where to restore the file encrypted in path: the
+// stored name next to it, or path without .qlq for files without one.
+func outputName(path string, h *qalqan.FileHeader) string {
+	name := filepath.Base(h.Name)
+	if h.Name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return strings.TrimSuffix(path, ".qlq")
+	}
+	return filepath.Join(filepath.Dir(path), name)
+}
+
+// writeOutput creates path, refusing to replace it unless force is set, and
+// fills it with write. A failed write removes the file.
+func writeOutput(path string, force bool, write func(io.Writer) error) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
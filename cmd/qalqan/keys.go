@@ -0,0 +1,132 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// keyFlags selects and unlocks the key set of a command.
+type keyFlags struct {
+	path       string
+	user       int
+	passwordFD int
+	useLedger  bool
+	newLedger  bool
+}
+
+// register adds the key flags to fs. Commands that hand out session keys
+// pass useLedger, which also adds -new-ledger; the others never read or
+// write the ledger.
+func (k *keyFlags) register(fs *flag.FlagSet, useLedger bool) {
+	fs.StringVar(&k.path, "keys", "", "key file (required)")
+	fs.IntVar(&k.user, "user", 1, "own user number in the key set")
+	fs.IntVar(&k.passwordFD, "password-fd", -1, "read the password from this file descriptor instead of the terminal")
+	k.useLedger = useLedger
+	if useLedger {
+		fs.BoolVar(&k.newLedger, "new-ledger", false, "start an empty record of used session keys when the key file has none")
+	}
+}
+
+// load unlocks the key file and returns a key store for the own user. With
+// useLedger the store also holds the ledger of used session keys kept next
+// to the file.
+func (k *keyFlags) load() (*qalqan.KeyStore, error) {
+	if k.path == "" {
+		return nil, fmt.Errorf("%w: -keys is required", errUsage)
+	}
+	f, err := os.Open(k.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	password, err := readPassword(k.passwordFD)
+	if err != nil {
+		return nil, err
+	}
+	set, err := qalqan.LoadKeySet(f, password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", k.path, err)
+	}
+	var ledger *qalqan.Ledger
+	if k.useLedger {
+		ledger, err = qalqan.OpenLedger(qalqan.LedgerPath(k.path), set)
+	}
+	if errors.Is(err, qalqan.ErrLedgerMissing) {
+		if k.newLedger {
+			ledger, err = qalqan.CreateLedger(qalqan.LedgerPath(k.path), set)
+		} else {
+			err = fmt.Errorf("%w; if its session keys have never been used, rerun with -new-ledger", err)
+		}
+	}
+	if err != nil {
+		set.Wipe()
+		return nil, err
+	}
+	keys := qalqan.NewKeyStore()
+	if err := keys.Load(set, k.user, ledger); err != nil {
+		set.Wipe()
+		return nil, err
+	}
+	return keys, nil
+}
+
+func runKeys(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: keys needs a subcommand: info or load", errUsage)
+	}
+	switch args[0] {
+	case "info":
+		return runKeysInfo(args[1:], stdout, stderr)
+	case "load":
+		return runKeysLoad(args[1:], stdout, stderr)
+	default:
+		return fmt.Errorf("%w: unknown keys subcommand %q", errUsage, args[0])
+	}
+}
+
+func runKeysInfo(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("keys info", stderr)
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	hdr, klen, users, err := qalqan.InspectKeyFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Fprintf(stdout, "format:   %s\n", hdr)
+	fmt.Fprintf(stdout, "key size: %d bytes\n", klen)
+	fmt.Fprintf(stdout, "users:    %d\n", users)
+	return nil
+}
+
+func runKeysLoad(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("keys load", stderr)
+	var kf keyFlags
+	kf.register(fs, true)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: keys load takes no arguments", errUsage)
+	}
+	keys, err := kf.load()
+	if err != nil {
+		return err
+	}
+	defer keys.Wipe()
+	fmt.Fprintln(stdout, keys)
+	fmt.Fprintf(stdout, "session keys left: %d\n", keys.Remaining())
+	return nil
+}
@@ -0,0 +1,150 @@
+// Command qalqan encrypts, decrypts and checks .qlq files without the GUI.
+//
+// Usage:
+//
+//	qalqan keys info KEYFILE
+//	qalqan keys load -keys KEYFILE [-user N]
+//	qalqan encrypt -keys KEYFILE [-user N] [-to N] [-key circle|session] [-mode CTR] [-o OUT] FILE
+//	qalqan encrypt -keys KEYFILE [-user N] [-to N] [-key circle|session] -archive [-o OUT] FILE|DIR...
+//	qalqan encrypt -keys KEYFILE [-user N] [-to N] [-key circle|session] -dir TARGET FILE|DIR...
+//	qalqan decrypt -keys KEYFILE [-user N] [-o OUT] FILE.qlq
+//	qalqan verify -keys KEYFILE [-user N] FILE.qlq
+//	qalqan inspect FILE.qlq
+//
+// The key file password is read from the terminal, or from the file
+// descriptor given with -password-fd. Used session keys are recorded in
+// KEYFILE.used; encrypt and keys load refuse a key file without one unless
+// -new-ledger starts an empty record, while decrypt and verify never touch
+// it. The exit status is 3 when an imit or
+// the hash of an archive entry does not match or the file is truncated, 4
+// for a wrong password or a file made for other keys, 5 when all session
+// keys have been used, 2 for usage errors and 1 for any other failure.
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitMAC      = 3
+	exitWrongKey = 4
+	exitNoKeys   = 5
+)
+
+var (
+	errUsage    = errors.New("usage")
+	errWrongKey = errors.New("the file was not encrypted with this key set")
+)
+
+const usage = `usage: qalqan <command> [flags] [file]
+
+commands:
+  keys info KEYFILE    show the layout of a key file
+  keys load            unlock a key file and show what it holds
+  encrypt FILE         encrypt FILE to FILE.qlq
+  encrypt -archive ... pack files and directories into one encrypted archive
+  encrypt -dir DIR ... encrypt each file to its own .qlq below DIR
+  decrypt FILE.qlq     decrypt to the original file name, or unpack an archive
+  verify FILE.qlq      check the imits without decrypting
+  inspect FILE.qlq     show the file header without a key
+
+Run "qalqan <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	var err error
+	switch args[0] {
+	case "keys":
+		err = runKeys(args[1:], stdout, stderr)
+	case "encrypt":
+		err = runEncrypt(args[1:], stdout, stderr)
+	case "decrypt":
+		err = runDecrypt(args[1:], stdout, stderr)
+	case "verify":
+		err = runVerify(args[1:], stdout, stderr)
+	case "inspect":
+		err = runInspect(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "qalqan: unknown command %q\n%s", args[0], usage)
+		return exitUsage
+	}
+	return exitCode(err, stderr)
+}
+
+// exitCode reports err on stderr and maps it to the exit status.
+func exitCode(err error, stderr io.Writer) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+	fmt.Fprintln(stderr, "qalqan:", err)
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, qalqan.ErrWrongPassword), errors.Is(err, errWrongKey):
+		return exitWrongKey
+	case errors.Is(err, qalqan.ErrMACMismatch), errors.Is(err, qalqan.ErrHashMismatch),
+		errors.Is(err, qalqan.ErrTruncated), errors.Is(err, qalqan.ErrBadPadding):
+		return exitMAC
+	case errors.Is(err, qalqan.ErrKeyExhausted):
+		return exitNoKeys
+	default:
+		return exitError
+	}
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("qalqan "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseArgs parses args into fs and returns its single positional argument.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("%w: %s takes exactly one file", errUsage, fs.Name())
+	}
+	return fs.Arg(0), nil
+}
+
+// parsePaths parses args into fs and returns its positional arguments, of
+// which there must be at least one.
+func parsePaths(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() == 0 {
+		return nil, fmt.Errorf("%w: %s needs a file", errUsage, fs.Name())
+	}
+	return fs.Args(), nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeKeys writes a key set for two users with cheap Argon2 parameters.
+func writeKeys(t *testing.T, dir, name, password string) string {
+	t.Helper()
+	hdr, err := qalqan.NewKeyFileHeader(qalqan.DEFAULT_KEY_LEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.Time, hdr.Memory, hdr.Threads = 1, 64, 1
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := qalqan.WriteKeySet(f, hdr, password, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	set, err := qalqan.LoadKeySet(f, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Wipe()
+	if _, err := qalqan.CreateLedger(qalqan.LedgerPath(path), set); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// passwordFDs keeps the pipes handed to the CLI reachable, so that their
+// finalizers do not close the descriptors readPassword has closed already.
+var passwordFDs []*os.File
+
+// passwordFD returns a -password-fd value that reads password.
+func passwordFD(t *testing.T, password string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.WriteString(password + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	passwordFDs = append(passwordFDs, r)
+	return strconv.Itoa(int(r.Fd()))
+}
+
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestCLIRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	keys := writeKeys(t, dir, "keys.bin", "secret")
+	plain := filepath.Join(dir, "report.txt")
+	data := bytes.Repeat([]byte("qalqan "), 20000)
+	if err := os.WriteFile(plain, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{"CTR", "CBC"} {
+		enc := filepath.Join(dir, "report-"+mode+".qlq")
+		if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-to", "2", "-mode", mode, "-o", enc, plain); code != exitOK {
+			t.Fatalf("%s encrypt: exit %d: %s", mode, code, out)
+		}
+		if code, out := runCLI(t, "verify", "-keys", keys, "-user", "2", "-password-fd", passwordFD(t, "secret"), enc); code != exitOK {
+			t.Fatalf("%s verify: exit %d: %s", mode, code, out)
+		}
+		if code, out := runCLI(t, "inspect", enc); code != exitOK || !strings.Contains(out, `"report.txt"`) || !strings.Contains(out, "user 2") {
+			t.Fatalf("%s inspect: exit %d: %s", mode, code, out)
+		}
+		dec := filepath.Join(dir, "restored-"+mode+".txt")
+		if code, out := runCLI(t, "decrypt", "-keys", keys, "-user", "2", "-password-fd", passwordFD(t, "secret"), "-o", dec, enc); code != exitOK {
+			t.Fatalf("%s decrypt: exit %d: %s", mode, code, out)
+		}
+		got, err := os.ReadFile(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: round trip mismatch", mode)
+		}
+	}
+
+	if code, out := runCLI(t, "keys", "info", keys); code != exitOK || !strings.Contains(out, "users:    2") {
+		t.Fatalf("keys info: exit %d: %s", code, out)
+	}
+	if code, out := runCLI(t, "keys", "load", "-keys", keys, "-password-fd", passwordFD(t, "secret")); code != exitOK || !strings.Contains(out, "session keys left: 98") {
+		t.Fatalf("keys load: exit %d: %s", code, out)
+	}
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	keys := writeKeys(t, dir, "keys.bin", "secret")
+	other := writeKeys(t, dir, "other.bin", "secret")
+	plain := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(plain, bytes.Repeat([]byte{7}, 10000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	enc := filepath.Join(dir, "a.qlq")
+	if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-key", "circle", "-o", enc, plain); code != exitOK {
+		t.Fatalf("encrypt: exit %d: %s", code, out)
+	}
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := filepath.Join(dir, "short.qlq")
+	if err := os.WriteFile(short, data[:len(data)-5], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.qlq")
+	data[len(data)/2] ^= 1
+	if err := os.WriteFile(bad, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"wrong password", []string{"verify", "-keys", keys, "-password-fd", passwordFD(t, "guess"), enc}, exitWrongKey},
+		{"other key set", []string{"verify", "-keys", other, "-password-fd", passwordFD(t, "secret"), enc}, exitMAC},
+		{"damaged file", []string{"decrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-o", filepath.Join(dir, "out"), bad}, exitMAC},
+		{"truncated file", []string{"decrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-o", filepath.Join(dir, "out"), short}, exitMAC},
+		{"no key file", []string{"verify", enc}, exitUsage},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"output exists", []string{"encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-o", enc, plain}, exitError},
+	} {
+		if code, out := runCLI(t, tc.args...); code != tc.want {
+			t.Errorf("%s: exit %d, want %d: %s", tc.name, code, tc.want, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); !os.IsNotExist(err) {
+		t.Errorf("failed decryption left its output behind: %v", err)
+	}
+
+	// A key file copied without its ledger must not hand out used keys again.
+	copied := filepath.Join(t.TempDir(), "keys.bin")
+	raw, err := os.ReadFile(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copied, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := runCLI(t, "keys", "load", "-keys", copied, "-password-fd", passwordFD(t, "secret")); code != exitError || !strings.Contains(out, "-new-ledger") {
+		t.Errorf("key file without ledger: exit %d: %s", code, out)
+	}
+	// Decrypting and verifying use no session keys and need no ledger.
+	if code, out := runCLI(t, "verify", "-keys", copied, "-password-fd", passwordFD(t, "secret"), enc); code != exitOK {
+		t.Errorf("verify without ledger: exit %d: %s", code, out)
+	}
+	if code, out := runCLI(t, "decrypt", "-keys", copied, "-password-fd", passwordFD(t, "secret"), "-o", filepath.Join(dir, "copy.bin"), enc); code != exitOK {
+		t.Errorf("decrypt without ledger: exit %d: %s", code, out)
+	}
+	if _, err := os.Stat(qalqan.LedgerPath(copied)); !os.IsNotExist(err) {
+		t.Errorf("verify or decrypt touched the ledger: %v", err)
+	}
+	if code, out := runCLI(t, "verify", "-keys", copied, "-password-fd", passwordFD(t, "secret"), "-new-ledger", enc); code != exitUsage {
+		t.Errorf("verify -new-ledger: exit %d, want %d: %s", code, exitUsage, out)
+	}
+	if code, out := runCLI(t, "keys", "load", "-keys", copied, "-password-fd", passwordFD(t, "secret"), "-new-ledger"); code != exitOK {
+		t.Errorf("-new-ledger: exit %d: %s", code, out)
+	}
+
+	many := filepath.Join(dir, "many")
+	if err := os.Mkdir(many, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= qalqan.SessionKeysPerUser; i++ {
+		if err := os.WriteFile(filepath.Join(many, fmt.Sprintf("%03d", i)), []byte{byte(i)}, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-dir", filepath.Join(dir, "many.enc"), many)
+	if code != exitNoKeys {
+		t.Errorf("session keys exhausted: exit %d, want %d: %s", code, exitNoKeys, out)
+	}
+}
+
+func TestCLIFolder(t *testing.T) {
+	dir := t.TempDir()
+	keys := writeKeys(t, dir, "keys.bin", "secret")
+	tree := map[string]string{"docs/a.txt": "first", "docs/sub/b.txt": strings.Repeat("second ", 5000)}
+	for name, data := range tree {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs := filepath.Join(dir, "docs")
+
+	if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), docs); code != exitUsage {
+		t.Fatalf("encrypting a directory without -archive or -dir: exit %d: %s", code, out)
+	}
+
+	archive := filepath.Join(dir, "docs.qlq")
+	if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-archive", "-o", archive, docs); code != exitOK {
+		t.Fatalf("encrypt -archive: exit %d: %s", code, out)
+	}
+	restored := filepath.Join(dir, "restored")
+	if code, out := runCLI(t, "decrypt", "-keys", keys, "-user", "2", "-password-fd", passwordFD(t, "secret"), "-o", restored, archive); code != exitOK {
+		t.Fatalf("decrypt archive: exit %d: %s", code, out)
+	}
+	for name, want := range tree {
+		got, err := os.ReadFile(filepath.Join(restored, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s: %q, %v", name, got, err)
+		}
+	}
+
+	target := filepath.Join(dir, "encrypted")
+	if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-key", "circle", "-dir", target, docs); code != exitOK || !strings.Contains(out, "2 files encrypted") {
+		t.Fatalf("encrypt -dir: exit %d: %s", code, out)
+	}
+	enc := filepath.Join(target, "docs", "sub", "b.txt.qlq")
+	dec := filepath.Join(dir, "b.txt")
+	if code, out := runCLI(t, "decrypt", "-keys", keys, "-user", "2", "-password-fd", passwordFD(t, "secret"), "-o", dec, enc); code != exitOK {
+		t.Fatalf("decrypt: exit %d: %s", code, out)
+	}
+	if got, err := os.ReadFile(dec); err != nil || string(got) != tree["docs/sub/b.txt"] {
+		t.Fatalf("restored %d bytes, %v", len(got), err)
+	}
+
+	// "." is stored under the directory's own name, next to it by default.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(docs, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if code, out := runCLI(t, "encrypt", "-keys", keys, "-password-fd", passwordFD(t, "secret"), "-archive", "."); code != exitOK {
+		t.Fatalf("encrypt -archive .: exit %d: %s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(docs, "sub.qlq")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readPassword reads the key file password from the file descriptor fd,
+// which is closed afterwards, or from the terminal without echo when fd is
+// negative. Only the first line is used.
+func readPassword(fd int) (string, error) {
+	if fd < 0 {
+		return readPasswordTTY("Password: ")
+	}
+	f := os.NewFile(uintptr(fd), "password-fd")
+	if f == nil {
+		return "", fmt.Errorf("%w: bad password file descriptor %d", errUsage, fd)
+	}
+	defer f.Close()
+	return readLine(f)
+}
+
+// readPasswordTTY prompts on the controlling terminal and reads a line
+// without echo.
+func readPasswordTTY(prompt string) (string, error) {
+	tty, err := openTTY()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to read the password from, use -password-fd: %w", err)
+	}
+	defer tty.Close()
+	fd := int(tty.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	// Ctrl-C still kills the process at the prompt; put echo back first.
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	defer close(done)
+	go func() {
+		select {
+		case <-sig:
+			term.Restore(fd, state)
+			fmt.Fprintln(tty)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	fmt.Fprint(tty, prompt)
+	defer fmt.Fprintln(tty)
+	pw, err := term.ReadPassword(fd)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return string(pw), nil
+}
+
+// openTTY opens the terminal itself, so that a redirected stdin is not read
+// as the password.
+func openTTY() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.OpenFile("CONIN$", os.O_RDWR, 0)
+	}
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -8,6 +8,9 @@ require (
 	fyne.io/fyne/v2 v2.6.1
 	github.com/google/uuid v1.3.1
 	github.com/pion/rtp v1.8.7
+	golang.org/x/crypto v0.38.0
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
 	maunium.net/go/mautrix v0.24.0
 )
 
@@ -39,7 +42,6 @@ require (
 	github.com/tidwall/sjson v1.2.5 // indirect
 	github.com/wlynxg/anet v0.0.3 // indirect
 	go.mau.fi/util v0.8.7 // indirect
-	golang.org/x/crypto v0.38.0 // indirect
 	golang.org/x/exp v0.0.0-20250506013437-ce4c2cf36ca6 // indirect
 )
 
@@ -71,7 +73,6 @@ require (
 	github.com/yuin/goldmark v1.7.11 // indirect
 	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/net v0.40.0 // indirect
-	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	layeh.com/gopus v0.0.0-20210501142526-1ee02d434e32
@@ -1,20 +1,41 @@
-package main
-
-import (
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/app"
-)
-
-var Version = "dev"
-var Commit = "none"
-var Date = "unknown"
-
-func main() {
-	myApp := app.NewWithID("QalqanDS")
-	myWindow := myApp.NewWindow("QalqanDS")
-	myWindow.Resize(fyne.NewSize(570, 300))
-	myWindow.CenterOnScreen()
-	myWindow.SetFixedSize(false)
-	InitUI(myApp, myWindow)
-	myWindow.ShowAndRun()
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+)
+
+var Version = "dev"
+var Commit = "none"
+var Date = "unknown"
+
+func main() {
+	myApp := app.NewWithID("QalqanDS")
+	myWindow := myApp.NewWindow("QalqanDS")
+	myWindow.Resize(fyne.NewSize(570, 300))
+	myWindow.CenterOnScreen()
+	myWindow.SetFixedSize(false)
+	keys := qalqan.NewKeyStore()
+	defer keys.Wipe()
+	myApp.Lifecycle().SetOnStopped(keys.Wipe)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		keys.Wipe()
+		os.Exit(1)
+	}()
+
+	if err := qalqan.SelfTest(); err != nil {
+		ShowSelfTestFailure(myApp, myWindow, err)
+	} else {
+		InitUI(myApp, myWindow, keys)
+	}
+	myWindow.ShowAndRun()
 }
\ No newline at end of file
@@ -0,0 +1,138 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"unsafe"
+)
+
+const (
+	aeadNonceSize = BLOCKLEN
+	aeadTagSize   = BLOCKLEN
+
+	labelEncKey = 0x01
+	labelMacKey = 0x02
+)
+
+// qalqanAEAD is an SIV construction: the imit over the nonce, additional
+// data and plaintext is the tag, and the tag is the OFB IV. Reusing a nonce
+// only reveals whether two messages are equal.
+type qalqanAEAD struct {
+	enc cipher.Block
+	mac cipher.Block
+}
+
+// NewAEAD returns a cipher.AEAD keyed by key. Separate encryption and MAC
+// keys of the same length are derived from it.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	master, err := NewCipher(key, BLOCKLEN)
+	if err != nil {
+		return nil, err
+	}
+	encKey := deriveKey(master, labelEncKey, len(key))
+	macKey := deriveKey(master, labelMacKey, len(key))
+	wipeBlock(master)
+	defer clear(encKey)
+	defer clear(macKey)
+
+	enc, err := NewCipher(encKey, BLOCKLEN)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := NewCipher(macKey, BLOCKLEN)
+	if err != nil {
+		return nil, err
+	}
+	return &qalqanAEAD{enc: enc, mac: mac}, nil
+}
+
+func deriveKey(b cipher.Block, label byte, klen int) []byte {
+	var in [BLOCKLEN]byte
+	in[0] = label
+	out := make([]byte, klen)
+	for i := 0; i < klen; i += BLOCKLEN {
+		in[BLOCKLEN-1] = byte(i / BLOCKLEN)
+		b.Encrypt(out[i:i+BLOCKLEN], in[:])
+	}
+	return out
+}
+
+func (a *qalqanAEAD) NonceSize() int { return aeadNonceSize }
+
+func (a *qalqanAEAD) Overhead() int { return aeadTagSize }
+
+func (a *qalqanAEAD) tag(nonce, plaintext, additionalData []byte) []byte {
+	m := &MAC{b: a.mac}
+	var lens [BLOCKLEN]byte
+	binary.LittleEndian.PutUint64(lens[:8], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lens[8:], uint64(len(plaintext)))
+	m.Write(lens[:])
+	m.Write(nonce)
+	m.Write(additionalData)
+	if rem := len(additionalData) % BLOCKLEN; rem != 0 {
+		var zero [BLOCKLEN]byte
+		m.Write(zero[:BLOCKLEN-rem])
+	}
+	m.Write(plaintext)
+	return m.Sum(nil)
+}
+
+func (a *qalqanAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != aeadNonceSize {
+		panic("qalqan: incorrect nonce length given to AEAD")
+	}
+	tag := a.tag(nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+aeadTagSize)
+	if inexactOverlap(out, plaintext) {
+		panic("qalqan: invalid buffer overlap")
+	}
+	cipher.NewOFB(a.enc, tag).XORKeyStream(out, plaintext)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+func (a *qalqanAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != aeadNonceSize {
+		panic("qalqan: incorrect nonce length given to AEAD")
+	}
+	if len(ciphertext) < aeadTagSize {
+		return nil, ErrMACMismatch
+	}
+	n := len(ciphertext) - aeadTagSize
+	tag := ciphertext[n:]
+
+	ret, out := sliceForAppend(dst, n)
+	if inexactOverlap(out, ciphertext) {
+		panic("qalqan: invalid buffer overlap")
+	}
+	cipher.NewOFB(a.enc, tag).XORKeyStream(out, ciphertext[:n])
+	if subtle.ConstantTimeCompare(a.tag(nonce, out, additionalData), tag) != 1 {
+		clear(out)
+		return nil, ErrMACMismatch
+	}
+	return ret, nil
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// inexactOverlap reports whether x and y share memory at different
+// offsets, which in-place Seal and Open cannot handle.
+func inexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+	xs := uintptr(unsafe.Pointer(&x[0]))
+	ys := uintptr(unsafe.Pointer(&y[0]))
+	return xs <= ys+uintptr(len(y)-1) && ys <= xs+uintptr(len(x)-1)
+}
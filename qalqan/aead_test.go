@@ -0,0 +1,101 @@
+package qalqan
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newTestAEAD(t *testing.T) (*qalqanAEAD, []byte) {
+	t.Helper()
+	a, err := NewAEAD(katKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*qalqanAEAD), katPlain(aeadNonceSize)
+}
+
+func TestAEADRoundTrip(t *testing.T) {
+	a, nonce := newTestAEAD(t)
+	ad := []byte("ledger v1")
+	for _, n := range []int{0, 1, 15, 16, 17, 100} {
+		plain := katData(n)
+		ct := a.Seal([]byte("prefix"), nonce, plain, ad)
+		if !bytes.HasPrefix(ct, []byte("prefix")) || len(ct) != len("prefix")+n+a.Overhead() {
+			t.Fatalf("len=%d: Seal returned %d bytes", n, len(ct))
+		}
+		ct = ct[len("prefix"):]
+		got, err := a.Open(nil, nonce, ct, ad)
+		if err != nil {
+			t.Fatalf("len=%d: %v", n, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("len=%d: round trip mismatch", n)
+		}
+
+		// In place, as the ledger does.
+		buf := append([]byte(nil), ct...)
+		got, err = a.Open(buf[:0], nonce, buf, ad)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("len=%d: in-place Open: %v", n, err)
+		}
+		buf = append(make([]byte, 0, n+a.Overhead()), plain...)
+		if sealed := a.Seal(buf[:0], nonce, buf, ad); !bytes.Equal(sealed, ct) {
+			t.Fatalf("len=%d: in-place Seal differs", n)
+		}
+	}
+}
+
+func TestAEADRejectsTampering(t *testing.T) {
+	a, nonce := newTestAEAD(t)
+	ad := []byte("ledger v1")
+	ct := a.Seal(nil, nonce, katData(40), ad)
+
+	otherNonce := append([]byte(nil), nonce...)
+	otherNonce[0] ^= 1
+	other, err := NewAEAD(katKey(48))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, open := range map[string]func() ([]byte, error){
+		"ciphertext": func() ([]byte, error) {
+			bad := append([]byte(nil), ct...)
+			bad[3] ^= 1
+			return a.Open(nil, nonce, bad, ad)
+		},
+		"tag": func() ([]byte, error) {
+			bad := append([]byte(nil), ct...)
+			bad[len(bad)-1] ^= 1
+			return a.Open(nil, nonce, bad, ad)
+		},
+		"additional data": func() ([]byte, error) { return a.Open(nil, nonce, ct, []byte("ledger v2")) },
+		"nonce":           func() ([]byte, error) { return a.Open(nil, otherNonce, ct, ad) },
+		"key":             func() ([]byte, error) { return other.Open(nil, nonce, ct, ad) },
+		"short":           func() ([]byte, error) { return a.Open(nil, nonce, ct[:aeadTagSize-1], ad) },
+	} {
+		if got, err := open(); !errors.Is(err, ErrMACMismatch) || got != nil {
+			t.Errorf("%s: Open = %x, %v; want ErrMACMismatch", name, got, err)
+		}
+	}
+}
+
+func TestAEADPanics(t *testing.T) {
+	a, nonce := newTestAEAD(t)
+	ct := a.Seal(nil, nonce, katData(32), nil)
+	buf := make([]byte, 64)
+	for name, f := range map[string]func(){
+		"Seal short nonce": func() { a.Seal(nil, nonce[:8], nil, nil) },
+		"Open long nonce":  func() { a.Open(nil, append(nonce, 0), ct, nil) },
+		"Seal overlap":     func() { a.Seal(buf[1:1], nonce, buf[:32], nil) },
+		"Open overlap":     func() { copy(buf, ct); a.Open(buf[1:1], nonce, buf[:len(ct)], nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,375 @@
+package qalqan
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+An archive packs several files and directories into the plaintext of one
+encrypted file, which then has file type FileTypeArchive:
+
+* contents of the files, in manifest order;
+* manifest, one entry per file or directory:
+  - type: 0x00 - file, 0x01 - directory;
+  - path length, uint16 little-endian;
+  - slash-separated relative path;
+  - size, uint64 little-endian;
+  - SHA-256 of the contents, zero for directories;
+* manifest length, uint32 little-endian;
+* entry count, uint32 little-endian;
+* magic "QLQA";
+* archive version.
+
+The manifest is at the end so that an archive can be written in one pass;
+it is found through the fixed-size trailer.
+*/
+
+const (
+	archiveVersion    = 1
+	archiveTrailerLen = 4 + 4 + 4 + 1
+	archiveEntryFile  = 0x00
+	archiveEntryDir   = 0x01
+	maxArchivePath    = 0xFFFF
+)
+
+var archiveMagic = []byte("QLQA")
+
+// ArchiveFile is a file or directory to be stored in an archive.
+type ArchiveFile struct {
+	Path string // where the file is read from
+	Name string // slash-separated path inside the archive
+	Dir  bool
+	Size uint64
+}
+
+// ArchiveEntry is a file or directory listed in an archive manifest.
+type ArchiveEntry struct {
+	Name   string
+	Dir    bool
+	Size   uint64
+	Hash   [sha256.Size]byte
+	offset int64
+}
+
+// Archive is the manifest of an archive read with ReadArchive.
+type Archive struct {
+	Entries []ArchiveEntry
+	r       io.ReaderAt
+}
+
+// CollectArchiveFiles lists paths for an archive. A file is stored under its
+// base name and a directory with everything below it under the directory's
+// base name, taken from the absolute path for "." and "..". Anything other
+// than regular files and directories is skipped.
+func CollectArchiveFiles(paths ...string) ([]ArchiveFile, error) {
+	var files []ArchiveFile
+	seen := make(map[string]bool)
+	add := func(f ArchiveFile) error {
+		if err := checkArchiveName(f.Name); err != nil {
+			return err
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("archive: %q is listed twice", f.Name)
+		}
+		seen[f.Name] = true
+		files = append(files, f)
+		return nil
+	}
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		base := filepath.Base(p)
+		if base == "." || base == ".." {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, err
+			}
+			base = filepath.Base(abs)
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().IsRegular() {
+			if err := add(ArchiveFile{Path: p, Name: base, Size: uint64(info.Size())}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !info.IsDir() {
+			continue
+		}
+		err = filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(p, file)
+			if err != nil {
+				return err
+			}
+			name := path.Join(base, filepath.ToSlash(rel))
+			switch {
+			case d.IsDir():
+				return add(ArchiveFile{Path: file, Name: name, Dir: true})
+			case d.Type().IsRegular():
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return add(ArchiveFile{Path: file, Name: name, Size: uint64(info.Size())})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// ArchiveSize returns the length of the archive WriteArchive makes of files.
+func ArchiveSize(files []ArchiveFile) uint64 {
+	var n uint64 = archiveTrailerLen
+	for _, f := range files {
+		n += f.Size + 1 + 2 + uint64(len(f.Name)) + 8 + sha256.Size
+	}
+	return n
+}
+
+// WriteArchive writes files to w as an archive of ArchiveSize(files) bytes.
+// It fails if a file no longer has the size it was listed with.
+func WriteArchive(w io.Writer, files []ArchiveFile) error {
+	bw := bufio.NewWriter(w)
+	var manifest bytes.Buffer
+	for _, f := range files {
+		if err := checkArchiveName(f.Name); err != nil {
+			return err
+		}
+		typ := byte(archiveEntryDir)
+		var sum [sha256.Size]byte
+		if !f.Dir {
+			typ = archiveEntryFile
+			var err error
+			if sum, err = copyArchiveFile(bw, f); err != nil {
+				return err
+			}
+		}
+		manifest.WriteByte(typ)
+		binary.Write(&manifest, binary.LittleEndian, uint16(len(f.Name)))
+		manifest.WriteString(f.Name)
+		binary.Write(&manifest, binary.LittleEndian, f.Size)
+		manifest.Write(sum[:])
+	}
+	trailer := binary.LittleEndian.AppendUint32(nil, uint32(manifest.Len()))
+	trailer = binary.LittleEndian.AppendUint32(trailer, uint32(len(files)))
+	trailer = append(append(trailer, archiveMagic...), archiveVersion)
+	if _, err := bw.Write(manifest.Bytes()); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	if _, err := bw.Write(trailer); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return bw.Flush()
+}
+
+func copyArchiveFile(w io.Writer, f ArchiveFile) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return sum, err
+	}
+	defer src.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(src, int64(f.Size)+1))
+	if err != nil {
+		return sum, err
+	}
+	if uint64(n) != f.Size {
+		return sum, fmt.Errorf("%s: file size changed: expected %d bytes, read %d", f.Path, f.Size, n)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// EncryptArchive writes files as an archive encrypted into a chunked file
+// described by h, setting its size and file type.
+func EncryptArchive(w io.Writer, h *FileHeader, imitKey, fileKey cipher.Block, files []ArchiveFile) error {
+	h.Size = ArchiveSize(files)
+	h.FileType = FileTypeArchive
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(WriteArchive(pw, files))
+	}()
+	err := WriteChunkedFile(w, h, imitKey, fileKey, pr)
+	pr.CloseWithError(errors.New("archive encryption stopped"))
+	return err
+}
+
+// ReadArchive reads the manifest of the size byte archive in r.
+func ReadArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	if size < archiveTrailerLen {
+		return nil, fmt.Errorf("archive: %w", ErrTruncated)
+	}
+	trailer := make([]byte, archiveTrailerLen)
+	if _, err := r.ReadAt(trailer, size-archiveTrailerLen); err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	if !bytes.Equal(trailer[8:12], archiveMagic) {
+		return nil, fmt.Errorf("archive trailer: %w", ErrTruncated)
+	}
+	if trailer[12] != archiveVersion {
+		return nil, fmt.Errorf("%w: archive version %d", ErrUnsupportedVersion, trailer[12])
+	}
+	manifestLen := int64(binary.LittleEndian.Uint32(trailer))
+	count := int(binary.LittleEndian.Uint32(trailer[4:]))
+	if manifestLen > size-archiveTrailerLen {
+		return nil, fmt.Errorf("archive manifest: %w", ErrTruncated)
+	}
+	manifest := make([]byte, manifestLen)
+	if _, err := r.ReadAt(manifest, size-archiveTrailerLen-manifestLen); err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+
+	a := &Archive{r: r}
+	seen := make(map[string]bool)
+	var offset int64
+	for i := 0; i < count; i++ {
+		if len(manifest) < 1+2 {
+			return nil, fmt.Errorf("archive manifest: %w", ErrTruncated)
+		}
+		typ := manifest[0]
+		nameLen := int(binary.LittleEndian.Uint16(manifest[1:]))
+		manifest = manifest[3:]
+		if len(manifest) < nameLen+8+sha256.Size {
+			return nil, fmt.Errorf("archive manifest: %w", ErrTruncated)
+		}
+		e := ArchiveEntry{
+			Name:   string(manifest[:nameLen]),
+			Dir:    typ == archiveEntryDir,
+			Size:   binary.LittleEndian.Uint64(manifest[nameLen:]),
+			offset: offset,
+		}
+		copy(e.Hash[:], manifest[nameLen+8:])
+		manifest = manifest[nameLen+8+sha256.Size:]
+
+		if typ != archiveEntryFile && typ != archiveEntryDir {
+			return nil, fmt.Errorf("archive entry %q: unknown type 0x%02X", e.Name, typ)
+		}
+		if err := checkArchiveName(e.Name); err != nil {
+			return nil, err
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("archive: %q is listed twice", e.Name)
+		}
+		seen[e.Name] = true
+		if e.Dir && e.Size != 0 {
+			return nil, fmt.Errorf("archive entry %q: directory with contents", e.Name)
+		}
+		if e.Size > uint64(size) || offset+int64(e.Size) > size-archiveTrailerLen-manifestLen {
+			return nil, fmt.Errorf("archive entry %q: %w", e.Name, ErrTruncated)
+		}
+		offset += int64(e.Size)
+		a.Entries = append(a.Entries, e)
+	}
+	if len(manifest) != 0 || offset != size-archiveTrailerLen-manifestLen {
+		return nil, fmt.Errorf("archive manifest does not match its contents: %w", ErrTruncated)
+	}
+	return a, nil
+}
+
+// Open returns the contents of e.
+func (a *Archive) Open(e *ArchiveEntry) io.Reader {
+	return io.NewSectionReader(a.r, e.offset, int64(e.Size))
+}
+
+// Extract restores the archive below dir, which must exist. It does not
+// replace existing files and refuses to write through symbolic links. A
+// file whose contents do not match its hash is removed and ErrHashMismatch
+// returned.
+func (a *Archive) Extract(dir string) error {
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		target := filepath.Join(dir, filepath.FromSlash(e.Name))
+		if err := makeArchiveDirs(dir, path.Dir(e.Name)); err != nil {
+			return err
+		}
+		if e.Dir {
+			if err := makeArchiveDirs(dir, e.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := a.extractFile(e, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) extractFile(e *ArchiveEntry, target string) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), a.Open(e))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !bytes.Equal(h.Sum(nil), e.Hash[:]) {
+		err = fmt.Errorf("archive entry %q: %w", e.Name, ErrHashMismatch)
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// makeArchiveDirs creates the slash-separated directory name below dir,
+// refusing to follow symbolic links on the way.
+func makeArchiveDirs(dir, name string) error {
+	if name == "." {
+		return nil
+	}
+	cur := dir
+	for _, part := range strings.Split(name, "/") {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.Mkdir(cur, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s: exists and is not a directory", cur)
+		}
+	}
+	return nil
+}
+
+// checkArchiveName rejects names that are not clean relative paths below
+// the extraction directory.
+func checkArchiveName(name string) error {
+	if name == "" || len(name) > maxArchivePath || strings.ContainsAny(name, "\\\x00") ||
+		path.Clean(name) != name || path.IsAbs(name) || name == "." ||
+		name == ".." || strings.HasPrefix(name, "../") || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("archive: unsafe path %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates files, keyed by slash-separated path, below dir.
+func writeTree(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// rawArchive builds an archive of entries with the given names and contents
+// without the checks of WriteArchive.
+func rawArchive(names []string, contents [][]byte) []byte {
+	var data, manifest bytes.Buffer
+	for i, name := range names {
+		data.Write(contents[i])
+		manifest.WriteByte(archiveEntryFile)
+		binary.Write(&manifest, binary.LittleEndian, uint16(len(name)))
+		manifest.WriteString(name)
+		binary.Write(&manifest, binary.LittleEndian, uint64(len(contents[i])))
+		sum := sha256.Sum256(contents[i])
+		manifest.Write(sum[:])
+	}
+	data.Write(manifest.Bytes())
+	binary.Write(&data, binary.LittleEndian, uint32(manifest.Len()))
+	binary.Write(&data, binary.LittleEndian, uint32(len(names)))
+	data.Write(archiveMagic)
+	data.WriteByte(archiveVersion)
+	return data.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	tree := map[string][]byte{
+		"docs/a.txt":         []byte("first"),
+		"docs/sub/b.bin":     katData(3*testChunk + 11),
+		"docs/sub/empty.txt": nil,
+		"single.pdf":         katData(100),
+	}
+	writeTree(t, src, tree)
+	if err := os.Mkdir(filepath.Join(src, "docs", "nothing"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := CollectArchiveFiles(filepath.Join(src, "docs"), filepath.Join(src, "single.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imitKey, fileKey := containerKeys(t)
+	h := &FileHeader{KeyLen: DEFAULT_KEY_LEN, KeyType: KeyTypeCircle, Sender: 1, ChunkSize: testChunk, Name: "docs.qlqa"}
+	var buf bytes.Buffer
+	if err := EncryptArchive(&buf, h, imitKey, fileKey, files); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Header.FileType != FileTypeArchive || f.Header.Size != ArchiveSize(files) {
+		t.Fatalf("header %+v", f.Header)
+	}
+	ra, err := f.NewReaderAt(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ReadArchive(ra, ra.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Entries) != len(files) {
+		t.Fatalf("%d entries, wrote %d", len(a.Entries), len(files))
+	}
+	dst := t.TempDir()
+	if err := a.Extract(dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range tree {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: contents differ", name)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dst, "docs", "nothing")); err != nil || !info.IsDir() {
+		t.Errorf("empty directory not restored: %v", err)
+	}
+	if err := a.Extract(dst); err == nil {
+		t.Error("extracting over existing files succeeded")
+	}
+}
+
+func TestArchiveRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../evil", "a/../../evil", "/etc/passwd", `..\evil`, "a//b", "./a", ".", ""} {
+		data := rawArchive([]string{name}, [][]byte{[]byte("x")})
+		if _, err := ReadArchive(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("ReadArchive accepted %q", name)
+		}
+	}
+	data := rawArchive([]string{"a", "a"}, [][]byte{[]byte("x"), []byte("y")})
+	if _, err := ReadArchive(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("ReadArchive accepted a duplicate name")
+	}
+}
+
+func TestCollectArchiveFilesCurrentDir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "project")
+	writeTree(t, root, map[string][]byte{"a.txt": []byte("a"), "sub/b.txt": []byte("b")})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, p := range []string{".", ".."} {
+		files, err := CollectArchiveFiles(p)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		want := map[string]string{".": "sub", "..": "project"}[p]
+		if len(files) == 0 || files[0].Name != want {
+			t.Fatalf("%s: first entry %+v, want %q", p, files, want)
+		}
+	}
+}
+
+func TestArchiveRefusesSymlinks(t *testing.T) {
+	dst := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dst, "link")); err != nil {
+		t.Skip("symlinks not available:", err)
+	}
+	data := rawArchive([]string{"link/x"}, [][]byte{[]byte("x")})
+	a, err := ReadArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Extract(dst); err == nil {
+		t.Fatal("extracted through a symbolic link")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "x")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file written outside the target: %v", err)
+	}
+}
+
+func TestArchiveRejectsDamage(t *testing.T) {
+	data := rawArchive([]string{"a.txt"}, [][]byte{[]byte("hello")})
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"no trailer", data[:len(data)-1]},
+		{"extra data", append([]byte("x"), data...)},
+		{"short", data[:4]},
+	} {
+		if _, err := ReadArchive(bytes.NewReader(tc.data), int64(len(tc.data))); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: err = %v, want ErrTruncated", tc.name, err)
+		}
+	}
+}
+
+func TestArchiveHashMismatch(t *testing.T) {
+	data := rawArchive([]string{"a.txt"}, [][]byte{[]byte("hello")})
+	data[0] ^= 1
+	a, err := ReadArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err := a.Extract(dst); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("err = %v, want ErrHashMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("damaged file left behind: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package qalqan
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+/*
+In version 2 files the header is followed by chunks of ChunkSize bytes of
+ciphertext, the last one shorter or empty, each followed by its imit:
+
+* ciphertext, CTR keystream starting at IV + index·ChunkSize/BLOCKLEN;
+* imit of the header imit, the chunk index (uint64 little-endian), the
+  final chunk flag (0x01 on the last chunk) and the ciphertext.
+
+There is no imit over the whole file: every chunk can be checked and
+decrypted on its own, and the final flag detects a file cut at a chunk
+boundary.
+*/
+
+const (
+	DefaultChunkSize = 64 << 10
+
+	minChunkShift = 12
+	maxChunkShift = 24
+)
+
+// chunkSizeShift returns log2 of size, which must be a power of two
+// between 4 KiB and 16 MiB.
+func chunkSizeShift(size int) (byte, error) {
+	for s := minChunkShift; s <= maxChunkShift; s++ {
+		if size == 1<<s {
+			return byte(s), nil
+		}
+	}
+	return 0, fmt.Errorf("chunk size %d must be a power of two from %d to %d", size, 1<<minChunkShift, 1<<maxChunkShift)
+}
+
+// chunkCount returns the number of chunks holding size bytes. An empty file
+// still has one, final, chunk.
+func chunkCount(size uint64, chunkSize int) uint64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + uint64(chunkSize) - 1) / uint64(chunkSize)
+}
+
+// chunkedBody locates the chunks of a version 2 file in its reader.
+type chunkedBody struct {
+	r       io.ReaderAt
+	start   int64
+	size    uint64
+	chunk   int
+	imitKey cipher.Block
+	tag     []byte
+}
+
+func (c *chunkedBody) count() uint64 {
+	return chunkCount(c.size, c.chunk)
+}
+
+// span returns the offset of chunk i in the file and its ciphertext length.
+func (c *chunkedBody) span(i uint64) (int64, int) {
+	off := c.start + int64(i)*int64(c.chunk+BLOCKLEN)
+	n := c.chunk
+	if i == c.count()-1 {
+		n = int(c.size - i*uint64(c.chunk))
+	}
+	return off, n
+}
+
+// verify checks the imits of all chunks.
+func (c *chunkedBody) verify() error {
+	buf := make([]byte, c.chunk+BLOCKLEN)
+	for i := uint64(0); i < c.count(); i++ {
+		if _, err := c.read(i, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads chunk i into buf, which holds at least a chunk and its imit,
+// checks the imit and returns the ciphertext.
+func (c *chunkedBody) read(i uint64, buf []byte) ([]byte, error) {
+	off, n := c.span(i)
+	if _, err := c.r.ReadAt(buf[:n+BLOCKLEN], off); err != nil {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		return nil, fmt.Errorf("chunk %d: %w", i, err)
+	}
+	ct, stored := buf[:n], buf[n:n+BLOCKLEN]
+	if subtle.ConstantTimeCompare(chunkImit(c.imitKey, c.tag, i, i == c.count()-1, ct), stored) != 1 {
+		return nil, fmt.Errorf("chunk %d: %w", i, ErrMACMismatch)
+	}
+	return ct, nil
+}
+
+func chunkImit(imitKey cipher.Block, tag []byte, i uint64, final bool, ct []byte) []byte {
+	var hdr [9]byte
+	binary.LittleEndian.PutUint64(hdr[:8], i)
+	if final {
+		hdr[8] = 0x01
+	}
+	m := &MAC{b: imitKey}
+	m.Write(tag)
+	m.Write(hdr[:])
+	m.Write(ct)
+	return m.Sum(nil)
+}
+
+// chunkIV returns the counter block that starts chunk i.
+func chunkIV(iv []byte, i uint64, chunkSize int) []byte {
+	ctr := append([]byte(nil), iv...)
+	addCounter(ctr, i*uint64(chunkSize/BLOCKLEN))
+	return ctr
+}
+
+type v2Format struct{}
+
+func (v2Format) Version() int { return ContainerV2 }
+
+func (v2Format) Open(r io.ReaderAt, size int64, imitKey cipher.Block) (*File, error) {
+	if imitKey.BlockSize() != BLOCKLEN {
+		return nil, BlockSizeError(imitKey.BlockSize())
+	}
+	h, hdr, err := readFileHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHeaderImit(hdr, imitKey); err != nil {
+		return nil, err
+	}
+	body := &chunkedBody{
+		r:       r,
+		start:   int64(len(hdr)),
+		size:    h.Size,
+		chunk:   h.ChunkSize,
+		imitKey: imitKey,
+		tag:     hdr[len(hdr)-BLOCKLEN:],
+	}
+	chunks := body.count()
+	if h.Size > uint64(size) || body.start+int64(h.Size)+int64(chunks)*BLOCKLEN != size {
+		return nil, fmt.Errorf("file is %d bytes, header says %d bytes of data: %w", size, h.Size, ErrTruncated)
+	}
+	return &File{Header: h, chunks: body}, nil
+}
+
+func (v2Format) Inspect(r io.ReaderAt, size int64) (*FileHeader, error) {
+	h, _, err := readFileHeader(r, size)
+	return h, err
+}
+
+// WriteChunkedFile encrypts src under fileKey and writes it to w as a
+// version 2 container described by h. src must hold exactly h.Size bytes.
+// The mode is always CTR; a zero h.ChunkSize selects DefaultChunkSize and a
+// nil h.IV is filled with a random one.
+func WriteChunkedFile(w io.Writer, h *FileHeader, imitKey, fileKey cipher.Block, src io.Reader) error {
+	h.Version = ContainerV2
+	h.Mode = ModeCTR
+	if h.ChunkSize == 0 {
+		h.ChunkSize = DefaultChunkSize
+	}
+	if h.IV == nil {
+		h.IV = make([]byte, BLOCKLEN)
+		if _, err := rand.Read(h.IV); err != nil {
+			return fmt.Errorf("generate IV: %w", err)
+		}
+	}
+	if fileKey.BlockSize() != BLOCKLEN {
+		return BlockSizeError(fileKey.BlockSize())
+	}
+	if imitKey.BlockSize() != BLOCKLEN {
+		return BlockSizeError(imitKey.BlockSize())
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tag := imitOf(imitKey, header)
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	if _, err := bw.Write(tag); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+
+	buf := make([]byte, h.ChunkSize)
+	chunks := chunkCount(h.Size, h.ChunkSize)
+	var read uint64
+	for i := uint64(0); i < chunks; i++ {
+		n := min(uint64(h.ChunkSize), h.Size-read)
+		m, err := io.ReadFull(src, buf[:n])
+		read += uint64(m)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return fmt.Errorf("file size changed during encryption: expected %d bytes, read %d", h.Size, read)
+		}
+		if err != nil {
+			return err
+		}
+		ct := buf[:n]
+		NewParallelCTR(fileKey, chunkIV(h.IV, i, h.ChunkSize), runtime.GOMAXPROCS(0)).XORKeyStream(ct, ct)
+		if _, err := bw.Write(ct); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+		if _, err := bw.Write(chunkImit(imitKey, tag, i, i == chunks-1, ct)); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+	}
+	if m, _ := src.Read(buf[:1]); m > 0 {
+		return fmt.Errorf("file size changed during encryption: expected %d bytes, read more", h.Size)
+	}
+	return bw.Flush()
+}
+
+// ChunkReader decrypts a version 2 file at arbitrary offsets, checking the
+// imit of every chunk it touches. It is safe for concurrent use.
+type ChunkReader struct {
+	body    *chunkedBody
+	fileKey cipher.Block
+	iv      []byte
+
+	mu     sync.Mutex
+	cached uint64
+	buf    []byte
+	plain  []byte
+	valid  bool
+}
+
+// NewReaderAt returns random access to the decrypted contents of a chunked
+// file.
+func (f *File) NewReaderAt(fileKey cipher.Block) (*ChunkReader, error) {
+	if f.chunks == nil {
+		return nil, fmt.Errorf("version %d files are not seekable", f.Header.Version)
+	}
+	if fileKey.BlockSize() != BLOCKLEN {
+		return nil, BlockSizeError(fileKey.BlockSize())
+	}
+	return &ChunkReader{
+		body:    f.chunks,
+		fileKey: fileKey,
+		iv:      f.Header.IV,
+		buf:     make([]byte, f.chunks.chunk+BLOCKLEN),
+		plain:   make([]byte, f.chunks.chunk),
+	}, nil
+}
+
+// Size returns the length of the decrypted contents.
+func (c *ChunkReader) Size() int64 {
+	return int64(c.body.size)
+}
+
+func (c *ChunkReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chunk := uint64(c.body.chunk)
+	n := 0
+	for len(p) > 0 {
+		if uint64(off) >= c.body.size {
+			return n, io.EOF
+		}
+		i := uint64(off) / chunk
+		plain, err := c.load(i)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p, plain[uint64(off)-i*chunk:])
+		n += m
+		p = p[m:]
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// load returns the plaintext of chunk i, verifying its imit.
+func (c *ChunkReader) load(i uint64) ([]byte, error) {
+	if c.valid && c.cached == i {
+		_, n := c.body.span(i)
+		return c.plain[:n], nil
+	}
+	c.valid = false
+	ct, err := c.body.read(i, c.buf)
+	if err != nil {
+		return nil, err
+	}
+	plain := c.plain[:len(ct)]
+	NewParallelCTR(c.fileKey, chunkIV(c.iv, i, c.body.chunk), runtime.GOMAXPROCS(0)).XORKeyStream(plain, ct)
+	c.cached, c.valid = i, true
+	return plain, nil
+}
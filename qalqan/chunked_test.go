@@ -0,0 +1,190 @@
+package qalqan
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+const testChunk = 1 << minChunkShift
+
+func writeChunked(t *testing.T, data []byte) []byte {
+	t.Helper()
+	imitKey, fileKey := containerKeys(t)
+	h := &FileHeader{
+		KeyLen:    DEFAULT_KEY_LEN,
+		KeyType:   KeyTypeCircle,
+		CircleKey: 5,
+		Sender:    1,
+		ChunkSize: testChunk,
+		Name:      "archive.tar",
+		Size:      uint64(len(data)),
+	}
+	var buf bytes.Buffer
+	if err := WriteChunkedFile(&buf, h, imitKey, fileKey, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	for _, n := range []int{0, 1, testChunk - 1, testChunk, testChunk + 1, 3*testChunk + 5} {
+		data := katData(n)
+		file := writeChunked(t, data)
+		if want := chunkCount(uint64(n), testChunk); file[4] != ContainerV2 ||
+			uint64(len(file)) < uint64(n)+want*BLOCKLEN {
+			t.Fatalf("len=%d: version %d, %d bytes", n, file[4], len(file))
+		}
+		h, got := openAll(t, file, imitKey, fileKey)
+		if !bytes.Equal(got, data) {
+			t.Fatalf("len=%d: round trip mismatch", n)
+		}
+		if h.Version != ContainerV2 || h.Mode != ModeCTR || h.ChunkSize != testChunk || h.Name != "archive.tar" {
+			t.Fatalf("len=%d: header %+v", n, h)
+		}
+	}
+}
+
+func TestChunkedReaderAt(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	data := katData(5*testChunk + 123)
+	file := writeChunked(t, data)
+	f, err := OpenFile(bytes.NewReader(file), int64(len(file)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := f.NewReaderAt(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", ra.Size(), len(data))
+	}
+	for _, span := range [][2]int{{0, 10}, {testChunk - 3, 7}, {3*testChunk + 1, 2 * testChunk}, {len(data) - 5, 5}, {100, 0}} {
+		p := make([]byte, span[1])
+		if _, err := ra.ReadAt(p, int64(span[0])); err != nil {
+			t.Fatalf("ReadAt(%d, %d): %v", span[0], span[1], err)
+		}
+		if !bytes.Equal(p, data[span[0]:span[0]+span[1]]) {
+			t.Fatalf("ReadAt(%d, %d): mismatch", span[0], span[1])
+		}
+	}
+	p := make([]byte, 10)
+	if n, err := ra.ReadAt(p, int64(len(data)-4)); n != 4 || err != io.EOF {
+		t.Fatalf("ReadAt past end = %d, %v", n, err)
+	}
+}
+
+func TestChunkedRejectsTampering(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	data := katData(3*testChunk + 100)
+	file := writeChunked(t, data)
+	f, err := OpenFile(bytes.NewReader(file), int64(len(file)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := f.chunks.start
+	stride := int64(testChunk + BLOCKLEN)
+
+	// A damaged chunk fails on its own; the others still decrypt.
+	bad := append([]byte(nil), file...)
+	bad[start+stride+10] ^= 1
+	f, err = OpenFile(bytes.NewReader(bad), int64(len(bad)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := f.NewReaderAt(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 16)
+	if _, err := ra.ReadAt(p, testChunk+5); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("damaged chunk: err = %v, want ErrMACMismatch", err)
+	}
+	if _, err := ra.ReadAt(p, 2*testChunk); err != nil || !bytes.Equal(p, data[2*testChunk:2*testChunk+16]) {
+		t.Fatalf("intact chunk: err = %v", err)
+	}
+
+	// Swapped chunks do not verify at the wrong index.
+	swapped := append([]byte(nil), file...)
+	copy(swapped[start:], file[start+stride:start+2*stride])
+	copy(swapped[start+stride:], file[start:start+stride])
+	f, err = OpenFile(bytes.NewReader(swapped), int64(len(swapped)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, _ = f.NewReaderAt(fileKey)
+	if _, err := ra.ReadAt(p, 0); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("swapped chunk: err = %v, want ErrMACMismatch", err)
+	}
+
+	// Cutting whole chunks off is caught before any data is read.
+	cut := file[:start+2*stride]
+	if _, err := OpenFile(bytes.NewReader(cut), int64(len(cut)), imitKey); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("truncated file: err = %v, want ErrTruncated", err)
+	}
+
+	hdr := append([]byte(nil), file...)
+	hdr[20] ^= 1
+	if _, err := OpenFile(bytes.NewReader(hdr), int64(len(hdr)), imitKey); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("damaged header: err = %v, want ErrMACMismatch", err)
+	}
+}
+
+func TestChunkedRejectsChunkSize(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	for _, size := range []int{1000, 1 << 11, 1 << 25} {
+		h := &FileHeader{KeyLen: DEFAULT_KEY_LEN, Sender: 1, ChunkSize: size, Name: "a"}
+		if err := WriteChunkedFile(io.Discard, h, imitKey, fileKey, bytes.NewReader(nil)); err == nil {
+			t.Errorf("chunk size %d accepted", size)
+		}
+	}
+}
+
+func BenchmarkChunkedReadAt(b *testing.B) {
+	imitKey, _ := NewCipher(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	fileKey, _ := NewCipher(katData(DEFAULT_KEY_LEN), BLOCKLEN)
+	data := katData(1 << 20)
+	var buf bytes.Buffer
+	h := &FileHeader{KeyLen: DEFAULT_KEY_LEN, Sender: 1, Name: "a", Size: uint64(len(data))}
+	if err := WriteChunkedFile(&buf, h, imitKey, fileKey, bytes.NewReader(data)); err != nil {
+		b.Fatal(err)
+	}
+	f, err := OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()), imitKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ra, _ := f.NewReaderAt(fileKey)
+	p := make([]byte, 4096)
+	b.SetBytes(int64(len(p)))
+	for i := 0; i < b.N; i++ {
+		off := int64(i*7919*BLOCKLEN) % (ra.Size() - int64(len(p)))
+		if _, err := ra.ReadAt(p, off); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	imitKey, _ := containerKeys(t)
+	file := writeChunked(t, katData(2*testChunk+7))
+	h, err := VerifyFile(bytes.NewReader(file), int64(len(file)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "archive.tar" || h.Size != 2*testChunk+7 || h.KeyName() != "circle key 5" {
+		t.Fatalf("header %+v, key %q", h, h.KeyName())
+	}
+
+	// OpenFile only checks the header of a chunked file; VerifyFile reads
+	// every chunk.
+	file[len(file)-BLOCKLEN-1] ^= 1
+	if _, err := OpenFile(bytes.NewReader(file), int64(len(file)), imitKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(bytes.NewReader(file), int64(len(file)), imitKey); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("damaged last chunk: err = %v, want ErrMACMismatch", err)
+	}
+}
@@ -0,0 +1,46 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"strconv"
+)
+
+// KeySizeError is returned for a key whose length Qalqan does not accept.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "qalqan: invalid key size " + strconv.Itoa(int(k))
+}
+
+// BlockSizeError is returned for a block length the cipher or mode does
+// not support.
+type BlockSizeError int
+
+func (b BlockSizeError) Error() string {
+	return "qalqan: invalid block size " + strconv.Itoa(int(b))
+}
+
+func checkKeyLen(klen int) error {
+	if klen < MINKEYLEN || klen > MAXKEYLEN || (klen-MINKEYLEN)%KEYLENSTEP != 0 {
+		return KeySizeError(klen)
+	}
+	return nil
+}
+
+// NewCipher expands key and returns a cipher.Block with the given block
+// length. The key must be MINKEYLEN..MAXKEYLEN bytes in KEYLENSTEP steps and
+// the block length one of 16, 32 or 64.
+func NewCipher(key []byte, blockLen int) (cipher.Block, error) {
+	k, err := NewKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return k.Expand(blockLen)
+}
+
+// wipeBlock zeroes b if it is a Qalqan cipher.
+func wipeBlock(b cipher.Block) {
+	if k, ok := b.(*ExpandedKey); ok {
+		k.Wipe()
+	}
+}
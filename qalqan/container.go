@@ -0,0 +1,626 @@
+package qalqan
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+/*
+Encrypted files (.qlq) written since version 1 start with a header:
+
+* 0 - 3   - magic "QLQF";
+* 4       - container version;
+* 5       - mode;
+* 6       - key length;
+* 7       - file type;
+* 8       - key type: 0x00 - circle, 0x01 - session;
+* 9       - circle key index;
+* 10      - session key index;
+* 11      - sender user number;
+* 12      - recipient user number, 0 - all users;
+* 13      - log2 of the chunk size in version 2, zero in version 1;
+* 14 - 15 - reserved, zero;
+* 16 - 17 - name length, little-endian;
+* name;
+* original size, uint64 little-endian;
+* IV;
+* imit of the header above.
+
+In version 1 the header is followed by the ciphertext and the imit of
+everything before it. Version 2 splits the data into chunks, see chunked.go.
+Imits are keyed by the imit key of the key set. Legacy files have no
+magic; they start with the 16 byte metadata block built by
+CreateFileMetadata and are read by the legacy format.
+*/
+
+const (
+	ContainerLegacy = 0
+	ContainerV1     = 1
+	ContainerV2     = 2
+
+	KeyTypeCircle  = 0x00
+	KeyTypeSession = 0x01
+
+	FileTypeOther    = 0x00
+	FileTypeDocument = 0x77
+	FileTypeImage    = 0x88
+	FileTypeText     = 0x66
+	FileTypeAudio    = 0x55
+	FileTypeArchive  = 0x44
+
+	containerFixedLen = 16
+	maxNameLen        = 255
+)
+
+var containerMagic = []byte("QLQF")
+
+// FileTypeFor returns the file type recorded for a file called name.
+func FileTypeFor(name string) byte {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".bmp", ".gif":
+		return FileTypeImage
+	case ".txt", ".md", ".log":
+		return FileTypeText
+	case ".mp3", ".wav", ".ogg":
+		return FileTypeAudio
+	case ".doc", ".docx", ".pdf", ".bin":
+		return FileTypeDocument
+	default:
+		return FileTypeOther
+	}
+}
+
+// FileHeader describes an encrypted file: who sent it to whom, which key
+// and mode protect it and what the original file was.
+type FileHeader struct {
+	Version    int
+	Mode       Mode
+	KeyLen     int
+	FileType   byte
+	KeyType    byte
+	CircleKey  int
+	SessionKey int
+	Sender     int
+	Recipient  int
+	ChunkSize  int
+	Name       string
+	Size       uint64
+	IV         []byte
+}
+
+// KeyName names the key that protects the file, such as "session key 42
+// of user 3".
+func (h *FileHeader) KeyName() string {
+	switch h.KeyType {
+	case KeyTypeCircle:
+		return fmt.Sprintf("circle key %d", h.CircleKey)
+	case KeyTypeSession:
+		return fmt.Sprintf("session key %d of user %d", h.SessionKey, h.Sender)
+	default:
+		return fmt.Sprintf("unknown key type 0x%02X", h.KeyType)
+	}
+}
+
+// MarshalBinary encodes a version 1 or 2 header up to and including the IV.
+func (h *FileHeader) MarshalBinary() ([]byte, error) {
+	var chunkShift byte
+	switch h.Version {
+	case ContainerV1:
+	case ContainerV2:
+		if h.Mode != ModeCTR {
+			return nil, fmt.Errorf("chunked files use CTR mode, not %v", h.Mode)
+		}
+		var err error
+		if chunkShift, err = chunkSizeShift(h.ChunkSize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: container version %d", ErrUnsupportedVersion, h.Version)
+	}
+	if err := checkKeyLen(h.KeyLen); err != nil {
+		return nil, err
+	}
+	if h.KeyType != KeyTypeCircle && h.KeyType != KeyTypeSession {
+		return nil, fmt.Errorf("%w 0x%02X", ErrUnknownKeyType, h.KeyType)
+	}
+	for _, f := range []struct {
+		name   string
+		v, max int
+	}{
+		{"circle key", h.CircleKey, CircleKeyCount - 1},
+		{"session key", h.SessionKey, SessionKeysPerUser - 1},
+		{"sender", h.Sender, MaxKeySetUsers},
+		{"recipient", h.Recipient, MaxKeySetUsers},
+	} {
+		if f.v < 0 || f.v > f.max {
+			return nil, fmt.Errorf("%s %d out of range 0..%d", f.name, f.v, f.max)
+		}
+	}
+	if len(h.IV) != BLOCKLEN {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", BLOCKLEN, len(h.IV))
+	}
+	name, err := sanitizeName(h.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, containerFixedLen, containerFixedLen+2+len(name)+8+BLOCKLEN)
+	copy(b, containerMagic)
+	b[4] = byte(h.Version)
+	b[5] = byte(h.Mode)
+	b[6] = byte(h.KeyLen)
+	b[7] = h.FileType
+	b[8] = h.KeyType
+	b[9] = byte(h.CircleKey)
+	b[10] = byte(h.SessionKey)
+	b[11] = byte(h.Sender)
+	b[12] = byte(h.Recipient)
+	b[13] = chunkShift
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(name)))
+	b = append(b, name...)
+	b = binary.LittleEndian.AppendUint64(b, h.Size)
+	return append(b, h.IV...), nil
+}
+
+// ParseFileHeader decodes a version 1 or 2 header from the start of data and
+// returns it with its encoded length. The header imit is not checked.
+func ParseFileHeader(data []byte) (*FileHeader, int, error) {
+	if !bytes.HasPrefix(data, containerMagic) {
+		return nil, 0, ErrNotQalqan
+	}
+	if len(data) < containerFixedLen+2 {
+		return nil, 0, fmt.Errorf("file header: %w", ErrTruncated)
+	}
+	if data[4] != ContainerV1 && data[4] != ContainerV2 {
+		return nil, 0, fmt.Errorf("%w: container version %d", ErrUnsupportedVersion, data[4])
+	}
+	h := &FileHeader{
+		Version:    int(data[4]),
+		Mode:       Mode(data[5]),
+		KeyLen:     int(data[6]),
+		FileType:   data[7],
+		KeyType:    data[8],
+		CircleKey:  int(data[9]),
+		SessionKey: int(data[10]),
+		Sender:     int(data[11]),
+		Recipient:  int(data[12]),
+	}
+	if h.Version == ContainerV2 {
+		if data[13] < minChunkShift || data[13] > maxChunkShift {
+			return nil, 0, fmt.Errorf("%w: chunk size 2^%d", ErrUnsupportedVersion, data[13])
+		}
+		if h.Mode != ModeCTR {
+			return nil, 0, fmt.Errorf("%w: chunked file in %v mode", ErrUnsupportedVersion, h.Mode)
+		}
+		h.ChunkSize = 1 << data[13]
+	}
+	pos := containerFixedLen
+	nameLen := int(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	if nameLen > maxNameLen {
+		return nil, 0, fmt.Errorf("file name length %d exceeds %d", nameLen, maxNameLen)
+	}
+	if len(data) < pos+nameLen+8+BLOCKLEN {
+		return nil, 0, fmt.Errorf("file header: %w", ErrTruncated)
+	}
+	h.Name = string(data[pos : pos+nameLen])
+	pos += nameLen
+	h.Size = binary.LittleEndian.Uint64(data[pos:])
+	pos += 8
+	h.IV = append([]byte(nil), data[pos:pos+BLOCKLEN]...)
+	pos += BLOCKLEN
+	return h, pos, nil
+}
+
+// Format reads one version of the .qlq layout.
+type Format interface {
+	// Version returns the container version handled, ContainerLegacy for
+	// files without magic.
+	Version() int
+	// Open authenticates the size bytes of r with imitKey and returns the
+	// decoded file.
+	Open(r io.ReaderAt, size int64, imitKey cipher.Block) (*File, error)
+	// Inspect decodes the header of the size bytes of r without
+	// authenticating anything.
+	Inspect(r io.ReaderAt, size int64) (*FileHeader, error)
+}
+
+var formats = map[int]Format{}
+
+// RegisterFormat makes f available to OpenFile, replacing any format of the
+// same version.
+func RegisterFormat(f Format) {
+	formats[f.Version()] = f
+}
+
+func init() {
+	RegisterFormat(legacyFormat{})
+	RegisterFormat(v1Format{})
+	RegisterFormat(v2Format{})
+}
+
+// File is an encrypted file whose header has been authenticated. The data
+// of version 1 and legacy files is authenticated too; chunks of version 2
+// files are checked as they are read.
+type File struct {
+	Header *FileHeader
+	body   *io.SectionReader
+	chunks *chunkedBody
+}
+
+// NewReader returns the decrypted contents of f under fileKey.
+func (f *File) NewReader(fileKey cipher.Block) (io.Reader, error) {
+	if f.chunks != nil {
+		ra, err := f.NewReaderAt(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(ra, 0, ra.Size()), nil
+	}
+	body := io.NewSectionReader(f.body, 0, f.body.Size())
+	if f.Header.Version != ContainerV1 {
+		return NewReader(body, f.Header.Mode, fileKey, f.Header.IV)
+	}
+
+	// Version 1 authenticates the size, so the stream modes are cut to it
+	// rather than to a guess at the padding of the last block.
+	mode := f.Header.Mode
+	if err := checkModeParams(mode, fileKey, f.Header.IV); err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	switch mode {
+	case ModeOFB:
+		r = cipher.StreamReader{S: cipher.NewOFB(fileKey, f.Header.IV), R: body}
+	case ModeCTR:
+		r = cipher.StreamReader{S: NewParallelCTR(fileKey, f.Header.IV, runtime.GOMAXPROCS(0)), R: body}
+	default:
+		dec, err := NewReader(body, mode, fileKey, f.Header.IV)
+		if err != nil {
+			return nil, err
+		}
+		r = dec
+	}
+	return &sizedReader{r: r, size: f.Header.Size, left: f.Header.Size}, nil
+}
+
+// sizedReader returns exactly size bytes of r and reports ErrTruncated if r
+// ends before that.
+type sizedReader struct {
+	r          io.Reader
+	size, left uint64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.left == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(p)) > s.left {
+		p = p[:s.left]
+	}
+	n, err := s.r.Read(p)
+	s.left -= uint64(n)
+	if err == io.EOF && s.left > 0 {
+		return n, fmt.Errorf("decrypted data ends before the %d bytes in the header: %w", s.size, ErrTruncated)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Verify checks the imit of every chunk of a chunked file without
+// decrypting it. The data of other files was checked by OpenFile.
+func (f *File) Verify() error {
+	if f.chunks == nil {
+		return nil
+	}
+	return f.chunks.verify()
+}
+
+// VerifyFile checks the header and data imits of the size bytes of r under
+// imitKey, without decrypting anything, and returns the header.
+func VerifyFile(r io.ReaderAt, size int64, imitKey cipher.Block) (*FileHeader, error) {
+	f, err := OpenFile(r, size, imitKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Verify(); err != nil {
+		return nil, err
+	}
+	return f.Header, nil
+}
+
+// DetectFormat returns the format of a file that starts with prefix, which
+// should hold at least the first containerFixedLen bytes.
+func DetectFormat(prefix []byte) (Format, error) {
+	version := ContainerLegacy
+	if bytes.HasPrefix(prefix, containerMagic) {
+		if len(prefix) <= len(containerMagic) {
+			return nil, fmt.Errorf("file header: %w", ErrTruncated)
+		}
+		version = int(prefix[len(containerMagic)])
+	} else if len(prefix) > 0 && prefix[0] != 0x00 {
+		return nil, ErrNotQalqan
+	}
+	f, ok := formats[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: container version %d", ErrUnsupportedVersion, version)
+	}
+	return f, nil
+}
+
+// OpenFile detects the format of the size bytes of r and opens it with
+// imitKey. A file whose imit does not match returns ErrMACMismatch; for
+// chunked files only the header is checked here.
+func OpenFile(r io.ReaderAt, size int64, imitKey cipher.Block) (*File, error) {
+	f, err := detect(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open(r, size, imitKey)
+}
+
+func detect(r io.ReaderAt, size int64) (Format, error) {
+	prefix := make([]byte, max(min(size, containerFixedLen), 0))
+	if _, err := r.ReadAt(prefix, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	return DetectFormat(prefix)
+}
+
+// InspectFile decodes the header of the size bytes of r without a key. The
+// result is not authenticated and is meant for display only.
+func InspectFile(r io.ReaderAt, size int64) (*FileHeader, error) {
+	f, err := detect(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return f.Inspect(r, size)
+}
+
+// WriteFile encrypts src under fileKey and writes it to w as a version 1
+// container described by h. src must hold exactly h.Size
+// bytes. A nil h.IV is filled with a random one and h.Version is set.
+func WriteFile(w io.Writer, h *FileHeader, imitKey, fileKey cipher.Block, src io.Reader) error {
+	h.Version = ContainerV1
+	if h.IV == nil {
+		h.IV = make([]byte, BLOCKLEN)
+		if _, err := rand.Read(h.IV); err != nil {
+			return fmt.Errorf("generate IV: %w", err)
+		}
+	}
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	mac, err := NewMAC(imitKey)
+	if err != nil {
+		return err
+	}
+	header = append(header, imitOf(imitKey, header)...)
+
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, mac)
+	if _, err := out.Write(header); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	enc, err := NewWriter(out, h.Mode, fileKey, h.IV)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(enc, src)
+	if err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if uint64(n) != h.Size {
+		return fmt.Errorf("file size changed during encryption: expected %d bytes, read %d", h.Size, n)
+	}
+	if _, err := bw.Write(mac.Sum(nil)); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return bw.Flush()
+}
+
+type v1Format struct{}
+
+func (v1Format) Version() int { return ContainerV1 }
+
+func (v1Format) Open(r io.ReaderAt, size int64, imitKey cipher.Block) (*File, error) {
+	if err := checkFileImit(r, size, imitKey); err != nil {
+		return nil, err
+	}
+	h, hdr, err := readFileHeader(r, size-BLOCKLEN)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHeaderImit(hdr, imitKey); err != nil {
+		return nil, err
+	}
+	start := int64(len(hdr))
+	body := io.NewSectionReader(r, start, size-BLOCKLEN-start)
+	if uint64(body.Size()) != cipherLen(h.Size, h.Mode) {
+		return nil, fmt.Errorf("ciphertext is %d bytes, header says %d bytes of data: %w", body.Size(), h.Size, ErrTruncated)
+	}
+	return &File{Header: h, body: body}, nil
+}
+
+func (v1Format) Inspect(r io.ReaderAt, size int64) (*FileHeader, error) {
+	h, _, err := readFileHeader(r, size)
+	return h, err
+}
+
+// readFileHeader decodes the version 1 or 2 header within the first size
+// bytes of r and returns it with its encoding, header imit included.
+func readFileHeader(r io.ReaderAt, size int64) (*FileHeader, []byte, error) {
+	maxHeader := int64(containerFixedLen + 2 + maxNameLen + 8 + 2*BLOCKLEN)
+	buf := make([]byte, max(min(size, maxHeader), 0))
+	if _, err := r.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("read failed: %w", err)
+	}
+	h, n, err := ParseFileHeader(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(buf) < n+BLOCKLEN {
+		return nil, nil, fmt.Errorf("file header: %w", ErrTruncated)
+	}
+	return h, buf[:n+BLOCKLEN], nil
+}
+
+// checkHeaderImit verifies the imit in the last block of hdr.
+func checkHeaderImit(hdr []byte, imitKey cipher.Block) error {
+	n := len(hdr) - BLOCKLEN
+	if subtle.ConstantTimeCompare(imitOf(imitKey, hdr[:n]), hdr[n:]) != 1 {
+		return fmt.Errorf("file header: %w", ErrMACMismatch)
+	}
+	return nil
+}
+
+// legacyFormat reads files written before the container had a version:
+//
+// * metadata block (see CreateFileMetadata);
+// * imit of the metadata block;
+// * optional name header as written by WriteHeader, without the metadata;
+// * IV;
+// * ciphertext;
+// * imit of everything before it.
+//
+// Files from before the name header carry none. It is taken as present only
+// when the size it declares matches the length of the remaining ciphertext.
+type legacyFormat struct{}
+
+func (legacyFormat) Version() int { return ContainerLegacy }
+
+func (legacyFormat) Open(r io.ReaderAt, size int64, imitKey cipher.Block) (*File, error) {
+	if size < 4*BLOCKLEN {
+		return nil, fmt.Errorf("file header: %w", ErrTruncated)
+	}
+	if err := checkFileImit(r, size, imitKey); err != nil {
+		return nil, err
+	}
+	h, hdr, err := readLegacyHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(imitOf(imitKey, hdr[:BLOCKLEN]), hdr[BLOCKLEN:2*BLOCKLEN]) != 1 {
+		return nil, fmt.Errorf("file metadata: %w", ErrMACMismatch)
+	}
+	start := int64(len(hdr))
+	return &File{Header: h, body: io.NewSectionReader(r, start, size-BLOCKLEN-start)}, nil
+}
+
+func (legacyFormat) Inspect(r io.ReaderAt, size int64) (*FileHeader, error) {
+	if size < 4*BLOCKLEN {
+		return nil, fmt.Errorf("file header: %w", ErrTruncated)
+	}
+	h, _, err := readLegacyHeader(r, size)
+	return h, err
+}
+
+// readLegacyHeader decodes the header of a legacy file of size bytes and
+// returns it with its encoding, from the metadata block to the IV.
+func readLegacyHeader(r io.ReaderAt, size int64) (*FileHeader, []byte, error) {
+	maxHeader := int64(2*BLOCKLEN + 2 + maxNameLen + 8 + BLOCKLEN)
+	buf := make([]byte, min(size-BLOCKLEN, maxHeader))
+	if _, err := r.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("read failed: %w", err)
+	}
+	meta := buf[:BLOCKLEN]
+	h := &FileHeader{
+		Version:    ContainerLegacy,
+		Sender:     int(meta[1]),
+		KeyLen:     int(meta[3]),
+		FileType:   meta[4],
+		KeyType:    meta[5],
+		CircleKey:  int(meta[6]),
+		SessionKey: int(meta[7]),
+		Mode:       Mode(meta[8]),
+		Recipient:  int(meta[9]),
+	}
+
+	pos := int64(2 * BLOCKLEN)
+	end := size - BLOCKLEN
+	if name, origSize, n, ok := legacyNameHeader(buf[pos:], end-pos, h.Mode); ok {
+		h.Name, h.Size = name, origSize
+		pos += int64(n)
+	}
+	if end-pos < BLOCKLEN {
+		return nil, nil, fmt.Errorf("file IV: %w", ErrTruncated)
+	}
+	h.IV = append([]byte(nil), buf[pos:pos+BLOCKLEN]...)
+	pos += BLOCKLEN
+	return h, buf[:pos], nil
+}
+
+// legacyNameHeader decodes the name header at the start of b if the rest of
+// the file, rest bytes from the start of b, holds an IV and exactly the
+// ciphertext for the size it declares.
+func legacyNameHeader(b []byte, rest int64, mode Mode) (string, uint64, int, bool) {
+	if len(b) < 2 {
+		return "", 0, 0, false
+	}
+	nameLen := int(binary.LittleEndian.Uint16(b))
+	if nameLen > maxNameLen || len(b) < 2+nameLen+8 {
+		return "", 0, 0, false
+	}
+	name := string(b[2 : 2+nameLen])
+	size := binary.LittleEndian.Uint64(b[2+nameLen:])
+	n := 2 + nameLen + 8
+	if sane, err := sanitizeName(name); err != nil || sane != name {
+		return "", 0, 0, false
+	}
+	body := rest - int64(n) - BLOCKLEN
+	if body < 0 || uint64(body) != cipherLen(size, mode) {
+		return "", 0, 0, false
+	}
+	return name, size, n, true
+}
+
+// cipherLen returns the length of size bytes encrypted by Writer in mode.
+func cipherLen(size uint64, mode Mode) uint64 {
+	if mode.padsFull() {
+		return (size/BLOCKLEN + 1) * BLOCKLEN
+	}
+	return (size + BLOCKLEN - 1) / BLOCKLEN * BLOCKLEN
+}
+
+// checkFileImit verifies the imit in the last block of the size bytes of r.
+func checkFileImit(r io.ReaderAt, size int64, imitKey cipher.Block) error {
+	if size < BLOCKLEN {
+		return fmt.Errorf("file imit: %w", ErrTruncated)
+	}
+	mac, err := NewMAC(imitKey)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(mac, io.NewSectionReader(r, 0, size-BLOCKLEN)); err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	stored := make([]byte, BLOCKLEN)
+	if _, err := r.ReadAt(stored, size-BLOCKLEN); err != nil && err != io.EOF {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if subtle.ConstantTimeCompare(mac.Sum(nil), stored) != 1 {
+		return ErrMACMismatch
+	}
+	return nil
+}
+
+func imitOf(imitKey cipher.Block, data []byte) []byte {
+	m := &MAC{b: imitKey}
+	m.Write(data)
+	return m.Sum(nil)
+}
@@ -0,0 +1,242 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+)
+
+func containerKeys(t *testing.T) (imitKey, fileKey cipher.Block) {
+	t.Helper()
+	imitKey, err := NewCipher(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileKey, err = NewCipher(katData(DEFAULT_KEY_LEN), BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imitKey, fileKey
+}
+
+func openAll(t *testing.T, data []byte, imitKey, fileKey cipher.Block) (*FileHeader, []byte) {
+	t.Helper()
+	f, err := OpenFile(bytes.NewReader(data), int64(len(data)), imitKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NewReader(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.Header, got
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	for _, mode := range []Mode{ModeOFB, ModeECB, ModeCBC, ModeCTR} {
+		for _, n := range []int{0, 1, BLOCKLEN, 1000} {
+			data := katData(n)
+			h := &FileHeader{
+				Mode:       mode,
+				KeyLen:     DEFAULT_KEY_LEN,
+				FileType:   FileTypeText,
+				KeyType:    KeyTypeSession,
+				SessionKey: 42,
+				Sender:     3,
+				Recipient:  7,
+				Name:       "notes.txt",
+				Size:       uint64(n),
+			}
+			var buf bytes.Buffer
+			if err := WriteFile(&buf, h, imitKey, fileKey, bytes.NewReader(data)); err != nil {
+				t.Fatalf("%v len=%d: %v", mode, n, err)
+			}
+			if !bytes.HasPrefix(buf.Bytes(), containerMagic) {
+				t.Fatalf("%v len=%d: missing magic", mode, n)
+			}
+			got, plain := openAll(t, buf.Bytes(), imitKey, fileKey)
+			if !bytes.Equal(plain, data) {
+				t.Fatalf("%v len=%d: round trip mismatch", mode, n)
+			}
+			if got.Version != ContainerV1 || got.Mode != mode || got.KeyLen != DEFAULT_KEY_LEN ||
+				got.FileType != FileTypeText || got.KeyType != KeyTypeSession || got.SessionKey != 42 ||
+				got.Sender != 3 || got.Recipient != 7 || got.Name != "notes.txt" || got.Size != uint64(n) ||
+				!bytes.Equal(got.IV, h.IV) {
+				t.Fatalf("%v len=%d: header %+v, wrote %+v", mode, n, got, h)
+			}
+		}
+	}
+}
+
+// TestContainerKeepsPaddingLookalikes checks that aligned data ending like
+// padding comes back whole: version 1 cuts to the authenticated size.
+func TestContainerKeepsPaddingLookalikes(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	for _, mode := range []Mode{ModeOFB, ModeECB, ModeCBC, ModeCTR} {
+		for _, tail := range [][]byte{{0x81}, {0x80, 0, 0, 1}} {
+			for _, n := range []int{2 * BLOCKLEN, 1024} {
+				data := katData(n)
+				copy(data[n-len(tail):], tail)
+				h := &FileHeader{Mode: mode, KeyLen: DEFAULT_KEY_LEN, KeyType: KeyTypeCircle, Name: "a.bin", Size: uint64(n)}
+				var buf bytes.Buffer
+				if err := WriteFile(&buf, h, imitKey, fileKey, bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+				if _, plain := openAll(t, buf.Bytes(), imitKey, fileKey); !bytes.Equal(plain, data) {
+					t.Errorf("%v len=%d tail %x: got %d bytes back", mode, n, tail, len(plain))
+				}
+			}
+		}
+	}
+}
+
+func TestContainerRejectsTampering(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	h := &FileHeader{KeyLen: DEFAULT_KEY_LEN, KeyType: KeyTypeCircle, Sender: 1, Name: "a.bin", Size: 100}
+	var buf bytes.Buffer
+	if err := WriteFile(&buf, h, imitKey, fileKey, bytes.NewReader(katData(100))); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+
+	for _, i := range []int{5, 20, len(file) - 40, len(file) - 1} {
+		data := append([]byte(nil), file...)
+		data[i] ^= 1
+		if _, err := OpenFile(bytes.NewReader(data), int64(len(data)), imitKey); !errors.Is(err, ErrMACMismatch) {
+			t.Errorf("flipped byte %d: err = %v, want ErrMACMismatch", i, err)
+		}
+	}
+
+	otherKey, err := NewCipher(katKey(DEFAULT_KEY_LEN+BLOCKLEN), BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(bytes.NewReader(file), int64(len(file)), otherKey); !errors.Is(err, ErrMACMismatch) {
+		t.Errorf("wrong imit key: err = %v, want ErrMACMismatch", err)
+	}
+
+	short := file[:len(file)/2]
+	if _, err := OpenFile(bytes.NewReader(short), int64(len(short)), imitKey); err == nil {
+		t.Error("truncated file opened")
+	}
+
+	future := append([]byte(nil), file...)
+	future[4] = ContainerV1 + 100
+	if _, err := OpenFile(bytes.NewReader(future), int64(len(future)), imitKey); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("unknown version: err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestParseFileHeaderErrors(t *testing.T) {
+	h := &FileHeader{Version: ContainerV2, Mode: ModeCTR, KeyLen: DEFAULT_KEY_LEN, KeyType: KeyTypeCircle,
+		Name: "a.bin", IV: katPlain(BLOCKLEN), ChunkSize: 1 << minChunkShift}
+	hdr, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		edit func(b []byte)
+		want error
+	}{
+		{"magic", func(b []byte) { b[0] = 'X' }, ErrNotQalqan},
+		{"version", func(b []byte) { b[4] = ContainerV2 + 1 }, ErrUnsupportedVersion},
+		{"chunk size", func(b []byte) { b[13] = maxChunkShift + 1 }, ErrUnsupportedVersion},
+		{"chunked mode", func(b []byte) { b[5] = byte(ModeOFB) }, ErrUnsupportedVersion},
+		{"short", nil, ErrTruncated},
+	} {
+		b := append([]byte(nil), hdr...)
+		if tc.edit != nil {
+			tc.edit(b)
+		} else {
+			b = b[:len(b)-1]
+		}
+		if _, _, err := ParseFileHeader(b); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+// legacyFile builds a file the way the application did before the
+// container had a version, with or without the name header.
+func legacyFile(t *testing.T, imitKey, fileKey cipher.Block, mode Mode, data []byte, name string) []byte {
+	t.Helper()
+	meta := CreateFileMetadata(2, 0, DEFAULT_KEY_LEN, FileTypeDocument, KeyTypeCircle, 4, 0, byte(mode))
+	var out bytes.Buffer
+	out.Write(meta[:])
+	out.Write(imitOf(imitKey, meta[:]))
+	if name != "" {
+		var hdr bytes.Buffer
+		if err := WriteHeader(&hdr, meta, name, uint64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+		out.Write(hdr.Bytes()[BLOCKLEN:])
+	}
+	iv := katPlain(BLOCKLEN)
+	out.Write(iv)
+	w, err := NewWriter(&out, mode, fileKey, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Write(imitOf(imitKey, out.Bytes()))
+	return out.Bytes()
+}
+
+func TestContainerLegacy(t *testing.T) {
+	imitKey, fileKey := containerKeys(t)
+	for _, mode := range []Mode{ModeOFB, ModeCBC} {
+		for _, name := range []string{"", "report.pdf"} {
+			data := katData(333)
+			file := legacyFile(t, imitKey, fileKey, mode, data, name)
+			if _, err := VerifyFile(bytes.NewReader(file), int64(len(file)), imitKey); err != nil {
+				t.Fatalf("%v name=%q: %v", mode, name, err)
+			}
+			got, plain := openAll(t, file, imitKey, fileKey)
+			if !bytes.Equal(plain, data) {
+				t.Fatalf("%v name=%q: round trip mismatch", mode, name)
+			}
+			if got.Version != ContainerLegacy || got.Sender != 2 || got.CircleKey != 4 ||
+				got.FileType != FileTypeDocument || got.Mode != mode || got.Name != name {
+				t.Fatalf("%v name=%q: header %+v", mode, name, got)
+			}
+			if name != "" && got.Size != uint64(len(data)) {
+				t.Fatalf("%v name=%q: size %d", mode, name, got.Size)
+			}
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, tc := range []struct {
+		prefix  []byte
+		version int
+		err     error
+	}{
+		{[]byte("QLQF\x01"), ContainerV1, nil},
+		{[]byte{0x00, 0x01, 0x04}, ContainerLegacy, nil},
+		{[]byte("QLQF\x09"), 0, ErrUnsupportedVersion},
+		{[]byte("PK\x03\x04"), 0, ErrNotQalqan},
+	} {
+		f, err := DetectFormat(tc.prefix)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("DetectFormat(%q) = %v, %v, want %v", tc.prefix, f, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || f.Version() != tc.version {
+			t.Errorf("DetectFormat(%q) = %v, %v, want version %d", tc.prefix, f, err, tc.version)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package qalqan
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// bigEndianTargets are run under QEMU user-mode emulation when it is
+// installed, to check that the cipher does not depend on host byte order.
+var bigEndianTargets = []struct {
+	goarch string
+	env    []string
+	qemu   []string
+}{
+	{"s390x", nil, []string{"qemu-s390x-static", "qemu-s390x"}},
+	{"mips", []string{"GOMIPS=softfloat"}, []string{"qemu-mips-static", "qemu-mips"}},
+}
+
+// TestBigEndianKAT cross-compiles the package tests for big-endian targets
+// and runs the known-answer tests under QEMU.
+func TestBigEndianKAT(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-compiles the tests")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("QEMU user-mode emulation needs a linux host")
+	}
+	goTool, err := exec.LookPath(filepath.Join(runtime.GOROOT(), "bin", "go"))
+	if err != nil {
+		t.Skip("go tool not found:", err)
+	}
+	for _, target := range bigEndianTargets {
+		t.Run(target.goarch, func(t *testing.T) {
+			var qemu string
+			for _, name := range target.qemu {
+				if qemu, err = exec.LookPath(name); err == nil {
+					break
+				}
+			}
+			if qemu == "" {
+				t.Skipf("%s not installed", target.qemu[len(target.qemu)-1])
+			}
+			bin := filepath.Join(t.TempDir(), "qalqan.test")
+			build := exec.Command(goTool, "test", "-c", "-o", bin, ".")
+			build.Env = append(os.Environ(), append(target.env, "GOOS=linux", "GOARCH="+target.goarch, "CGO_ENABLED=0")...)
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("build for %s: %v\n%s", target.goarch, err, out)
+			}
+			run := exec.Command(qemu, bin, "-test.short", "-test.run", "KAT|RoundTrip|Myremove")
+			if out, err := run.CombinedOutput(); err != nil {
+				t.Fatalf("tests on %s: %v\n%s", target.goarch, err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// minBlocksPerWorker keeps goroutine overhead small compared to the work
+// handed to each of them.
+const minBlocksPerWorker = 256
+
+// parallelCTR produces the same keystream as cipher.NewCTR: the IV is a
+// big-endian counter over the whole block. Large inputs are split across
+// workers, each starting from its own counter offset.
+type parallelCTR struct {
+	b       cipher.Block
+	ctr     []byte
+	ks      []byte
+	used    int
+	workers int
+}
+
+// NewParallelCTR returns a CTR cipher.Stream that uses up to workers
+// goroutines. It is interchangeable with cipher.NewCTR(b, iv).
+func NewParallelCTR(b cipher.Block, iv []byte, workers int) cipher.Stream {
+	bs := b.BlockSize()
+	if len(iv) != bs {
+		panic("qalqan: IV length must equal block size")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return &parallelCTR{
+		b:       b,
+		ctr:     append([]byte(nil), iv...),
+		ks:      make([]byte, bs),
+		used:    bs,
+		workers: workers,
+	}
+}
+
+// NewCTRWriter returns a Writer that encrypts to w in CTR mode on up to
+// workers goroutines. Like the block modes it always ends with a padding
+// block, so block-aligned data decrypts unchanged.
+func NewCTRWriter(w io.Writer, b cipher.Block, iv []byte, workers int) (*Writer, error) {
+	if len(iv) != b.BlockSize() {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", b.BlockSize(), len(iv))
+	}
+	return newWriter(w, NewParallelCTR(b, iv, workers).XORKeyStream, ModeCTR.padsFull(), ctrBufSize(workers)), nil
+}
+
+// NewCTRReader returns a Reader that decrypts CTR ciphertext on up to
+// workers goroutines.
+func NewCTRReader(r io.Reader, b cipher.Block, iv []byte, workers int) (*Reader, error) {
+	if len(iv) != b.BlockSize() {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", b.BlockSize(), len(iv))
+	}
+	return newReader(r, NewParallelCTR(b, iv, workers).XORKeyStream, ModeCTR.padsFull(), ctrBufSize(workers)), nil
+}
+
+func ctrBufSize(workers int) int {
+	if workers <= 1 {
+		return streamBufSize
+	}
+	return workers * streamBufSize
+}
+
+func (c *parallelCTR) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("qalqan: output smaller than input")
+	}
+	bs := len(c.ctr)
+
+	for len(src) > 0 && c.used < bs {
+		n := subtle.XORBytes(dst, src, c.ks[c.used:])
+		c.used += n
+		dst, src = dst[n:], src[n:]
+	}
+
+	if blocks := len(src) / bs; blocks > 0 {
+		n := blocks * bs
+		c.xorBlocks(dst[:n], src[:n], blocks)
+		dst, src = dst[n:], src[n:]
+	}
+
+	if len(src) > 0 {
+		c.b.Encrypt(c.ks, c.ctr)
+		addCounter(c.ctr, 1)
+		c.used = subtle.XORBytes(dst, src, c.ks)
+	}
+}
+
+func (c *parallelCTR) xorBlocks(dst, src []byte, blocks int) {
+	bs := len(c.ctr)
+	workers := min(c.workers, blocks/minBlocksPerWorker)
+	if workers <= 1 {
+		xorCounterBlocks(c.b, c.ctr, dst, src)
+		addCounter(c.ctr, uint64(blocks))
+		return
+	}
+
+	per := (blocks + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < blocks; start += per {
+		end := min(start+per, blocks)
+		ctr := append([]byte(nil), c.ctr...)
+		addCounter(ctr, uint64(start))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			xorCounterBlocks(c.b, ctr, dst[start*bs:end*bs], src[start*bs:end*bs])
+		}()
+	}
+	wg.Wait()
+	addCounter(c.ctr, uint64(blocks))
+}
+
+// xorCounterBlocks encrypts successive counter values starting at a copy of
+// ctr and XORs them into src.
+func xorCounterBlocks(b cipher.Block, ctr, dst, src []byte) {
+	bs := len(ctr)
+	c := append([]byte(nil), ctr...)
+	ks := make([]byte, bs)
+	for i := 0; i < len(src); i += bs {
+		b.Encrypt(ks, c)
+		subtle.XORBytes(dst[i:i+bs], src[i:i+bs], ks)
+		addCounter(c, 1)
+	}
+}
+
+func addCounter(ctr []byte, n uint64) {
+	for i := len(ctr) - 1; i >= 0 && n > 0; i-- {
+		s := uint64(ctr[i]) + n&0xff
+		ctr[i] = byte(s)
+		n = n>>8 + s>>8
+	}
+}
@@ -0,0 +1,70 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestParallelCTRMatchesStdlib(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for _, blen := range []int{16, 32, 64} {
+		b, err := NewCipher(key, blen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv := bytes.Repeat([]byte{0xff}, blen)
+		iv[0] = 0x01
+
+		src := make([]byte, 3*minBlocksPerWorker*blen+7)
+		for i := range src {
+			src[i] = byte(i * 7)
+		}
+		want := make([]byte, len(src))
+		cipher.NewCTR(b, iv).XORKeyStream(want, src)
+
+		for _, workers := range []int{1, 2, 3, 8} {
+			got := make([]byte, len(src))
+			s := NewParallelCTR(b, iv, workers)
+			for off, step := 0, 1; off < len(src); step = step*3 + 5 {
+				end := min(off+step, len(src))
+				s.XORKeyStream(got[off:end], src[off:end])
+				off = end
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("blen=%d workers=%d: keystream differs from cipher.NewCTR", blen, workers)
+			}
+		}
+	}
+}
+
+func BenchmarkCTR(b *testing.B) {
+	const size = 4 << 20
+	key := make([]byte, 32)
+	src := make([]byte, size)
+	for _, blen := range []int{16, 32, 64} {
+		block, err := NewCipher(key, blen)
+		if err != nil {
+			b.Fatal(err)
+		}
+		iv := make([]byte, blen)
+		for _, workers := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("blen=%d/workers=%d", blen, workers), func(b *testing.B) {
+				b.SetBytes(size)
+				for i := 0; i < b.N; i++ {
+					w, err := NewCTRWriter(io.Discard, block, iv, workers)
+					if err != nil {
+						b.Fatal(err)
+					}
+					w.Write(src)
+					w.Close()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package qalqan
+
+import "errors"
+
+var (
+	ErrBadPadding         = errors.New("bad padding")
+	ErrMACMismatch        = errors.New("imit mismatch: data is corrupted or the key is wrong")
+	ErrWrongPassword      = errors.New("wrong password")
+	ErrTruncated          = errors.New("data is truncated")
+	ErrBadUserCount       = errors.New("bad user count")
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	ErrHashMismatch       = errors.New("content hash does not match the manifest")
+	ErrUnknownKeyType     = errors.New("unknown key type")
+	ErrKeysNotLoaded      = errors.New("keys are not loaded")
+	ErrKeyExhausted       = errors.New("no unused session keys left")
+	ErrSelfTest           = errors.New("cryptographic self-test failed")
+	ErrLedgerMissing      = errors.New("session key ledger is missing")
+	ErrNotQalqan          = errors.New("not a qalqan file")
+)
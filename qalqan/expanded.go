@@ -0,0 +1,470 @@
+package qalqan
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"runtime"
+)
+
+/*
+ExpandedKey runs the same rounds as Encrypt and DecryptOFB used to run
+byte by byte, with the work moved out of the per-block path:
+
+* the modular additions of the first and last round keys are done on 64-bit
+  words with carries instead of byte by byte;
+* the state stays in the 32- or 64-bit words that Lin344, Lin384 and Lin388
+  work on from the first round to the last, so no round converts between
+  bytes and words, and the S-box and the linear layer run on those words
+  with the rotations unrolled;
+* nothing is allocated per block, and the decryption rounds use the round
+  keys as Kexp makes them, so Encrypt and DecryptOFB wrap their round keys
+  in an ExpandedKey and share these rounds.
+
+A 16-byte block could also fuse the S-box into Lin344 through sixteen
+256-entry tables, but those take 64 KiB per direction, do not fit in L1,
+and measured no faster than the word rounds.
+
+Against the byte-wise rounds (BenchmarkExpandedKeyEncrypt and
+BenchmarkExpandedKeyDecrypt) this measured 2.5-3x faster for every block
+length on amd64. Most of what is left is the 16 to 64 S-box lookups per
+round and the linear layers, whose words are updated one after another, so
+a single block has little left to run in parallel.
+*/
+
+var le = binary.LittleEndian
+
+// Key is a Qalqan key whose length has been checked. It refers to the bytes
+// it was made from and does not copy them.
+type Key struct {
+	b []byte
+}
+
+// NewKey returns b as a Key. It must be MINKEYLEN..MAXKEYLEN bytes long in
+// KEYLENSTEP steps.
+func NewKey(b []byte) (Key, error) {
+	if err := checkKeyLen(len(b)); err != nil {
+		return Key{}, err
+	}
+	return Key{b: b}, nil
+}
+
+// Len returns the key length in bytes.
+func (k Key) Len() int { return len(k.b) }
+
+// Expand returns the key schedule of k for blocks of blockLen bytes.
+func (k Key) Expand(blockLen int) (*ExpandedKey, error) {
+	return NewExpandedKey(k, blockLen)
+}
+
+// ExpandedKey is the key schedule of a Key for one block length. It
+// implements cipher.Block.
+type ExpandedKey struct {
+	klen, blen, rounds int
+	rk                 []byte // round keys as Kexp makes them, blen bytes per round
+	mem                *SecureBuffer
+}
+
+// NewExpandedKey expands key for blocks of blockLen bytes, which must be
+// 16, 32 or 64. The schedule is kept in a SecureBuffer and zeroed by Wipe or
+// when the ExpandedKey is garbage collected.
+func NewExpandedKey(key Key, blockLen int) (*ExpandedKey, error) {
+	if err := checkKeyLen(key.Len()); err != nil {
+		return nil, err
+	}
+	switch blockLen {
+	case 16, 32, 64:
+	default:
+		return nil, BlockSizeError(blockLen)
+	}
+	klen := key.Len()
+	n := ExpKeyLen(klen, blockLen)
+	mem := NewSecureBuffer(n)
+	k := &ExpandedKey{
+		klen:   klen,
+		blen:   blockLen,
+		rounds: int(RNDS(uint32(klen))),
+		rk:     mem.Bytes()[:n],
+		mem:    mem,
+	}
+	Kexp(key.b, klen, blockLen, k.rk)
+	runtime.SetFinalizer(k, (*ExpandedKey).Wipe)
+	return k, nil
+}
+
+// expandedRoundKeys wraps round keys made by Kexp. It copies nothing, so
+// it costs no more than the byte-wise rounds did to set up.
+func expandedRoundKeys(rkey []byte, klen, blen int) *ExpandedKey {
+	switch blen {
+	case 16, 32, 64:
+	default:
+		panic("qalqan: unexpected block length")
+	}
+	return &ExpandedKey{
+		klen:   klen,
+		blen:   blen,
+		rounds: int(RNDS(uint32(klen))),
+		rk:     rkey[:ExpKeyLen(klen, blen)],
+	}
+}
+
+// KeyLen returns the length of the key the schedule was made from.
+func (k *ExpandedKey) KeyLen() int { return k.klen }
+
+// BlockSize returns the block length.
+func (k *ExpandedKey) BlockSize() int { return k.blen }
+
+// Encrypt encrypts the first block of src into dst.
+func (k *ExpandedKey) Encrypt(dst, src []byte) {
+	k.check(dst, src)
+	switch k.blen {
+	case 16:
+		k.encrypt16(dst, src)
+	case 32:
+		k.encrypt32(dst, src)
+	default:
+		k.encrypt64(dst, src)
+	}
+	// The rounds read the schedule through local slices; keep k reachable
+	// so that its finalizer cannot wipe the schedule in the middle.
+	runtime.KeepAlive(k)
+}
+
+// Decrypt decrypts the first block of src into dst.
+func (k *ExpandedKey) Decrypt(dst, src []byte) {
+	k.check(dst, src)
+	switch k.blen {
+	case 16:
+		k.decrypt16(dst, src)
+	case 32:
+		k.decrypt32(dst, src)
+	default:
+		k.decrypt64(dst, src)
+	}
+	runtime.KeepAlive(k) // see Encrypt
+}
+
+func (k *ExpandedKey) check(dst, src []byte) {
+	if k.rk == nil {
+		panic("qalqan: use of a wiped key")
+	}
+	if len(src) < k.blen {
+		panic("qalqan: input not full block")
+	}
+	if len(dst) < k.blen {
+		panic("qalqan: output not full block")
+	}
+}
+
+// Wipe zeroes the schedule. The key must not be used afterwards.
+func (k *ExpandedKey) Wipe() {
+	if k.mem != nil {
+		k.mem.Release()
+	}
+	k.rk = nil
+}
+
+// addWords sets dst to the little-endian sum a+b modulo 2^(8*len(dst)).
+func addWords(dst, a, b []byte) {
+	var c uint64
+	for i := 0; i < len(dst); i += 8 {
+		var s uint64
+		s, c = bits.Add64(le.Uint64(a[i:]), le.Uint64(b[i:]), c)
+		le.PutUint64(dst[i:], s)
+	}
+}
+
+// subWords sets dst to the little-endian difference a-b modulo 2^(8*len(dst)).
+func subWords(dst, a, b []byte) {
+	var c uint64
+	for i := 0; i < len(dst); i += 8 {
+		var s uint64
+		s, c = bits.Sub64(le.Uint64(a[i:]), le.Uint64(b[i:]), c)
+		le.PutUint64(dst[i:], s)
+	}
+}
+
+// The rounds keep their state in the words Lin344, Lin384 and Lin388 work
+// on. Each layer updates word i from word i itself and the words after it,
+// wrapping round to the words already updated, so they run in place; the
+// inverse runs the same step from the last word down. Every round function
+// ends by XORing in the next round key, so the state is stored only once
+// per round; the round before the final addition takes noRoundKey.
+
+var noRoundKey [64]byte
+
+func sub32(x uint32, s *[256]byte) uint32 {
+	return uint32(s[byte(x)]) | uint32(s[byte(x>>8)])<<8 | uint32(s[byte(x>>16)])<<16 | uint32(s[x>>24])<<24
+}
+
+func sub64(x uint64, s *[256]byte) uint64 {
+	return uint64(s[byte(x)]) | uint64(s[byte(x>>8)])<<8 | uint64(s[byte(x>>16)])<<16 | uint64(s[byte(x>>24)])<<24 |
+		uint64(s[byte(x>>32)])<<32 | uint64(s[byte(x>>40)])<<40 | uint64(s[byte(x>>48)])<<48 | uint64(s[x>>56])<<56
+}
+
+// sublin16 sets x to Lin344(S(x)) ^ key.
+func sublin16(x *[4]uint32, key []byte) {
+	_ = key[15]
+	x0, x1, x2, x3 := x[0], x[1], x[2], x[3]
+	x0 = sub32(x0, &sb)
+	x1 = sub32(x1, &sb)
+	x2 = sub32(x2, &sb)
+	x3 = sub32(x3, &sb)
+	x0 = x0 ^ bits.RotateLeft32(x1, 1) ^ bits.RotateLeft32(x2, 17) ^ bits.RotateLeft32(x3, 14)
+	x1 = x1 ^ bits.RotateLeft32(x2, 1) ^ bits.RotateLeft32(x3, 17) ^ bits.RotateLeft32(x0, 14)
+	x2 = x2 ^ bits.RotateLeft32(x3, 1) ^ bits.RotateLeft32(x0, 17) ^ bits.RotateLeft32(x1, 14)
+	x3 = x3 ^ bits.RotateLeft32(x0, 1) ^ bits.RotateLeft32(x1, 17) ^ bits.RotateLeft32(x2, 14)
+	x[0], x[1], x[2], x[3] = x0^le.Uint32(key[0:]), x1^le.Uint32(key[4:]), x2^le.Uint32(key[8:]), x3^le.Uint32(key[12:])
+}
+
+// invsublin16 sets x to S^-1(Ilin344(x)) ^ key.
+func invsublin16(x *[4]uint32, key []byte) {
+	_ = key[15]
+	x0, x1, x2, x3 := x[0], x[1], x[2], x[3]
+	x3 = x3 ^ bits.RotateLeft32(x0, 1) ^ bits.RotateLeft32(x1, 17) ^ bits.RotateLeft32(x2, 14)
+	x2 = x2 ^ bits.RotateLeft32(x3, 1) ^ bits.RotateLeft32(x0, 17) ^ bits.RotateLeft32(x1, 14)
+	x1 = x1 ^ bits.RotateLeft32(x2, 1) ^ bits.RotateLeft32(x3, 17) ^ bits.RotateLeft32(x0, 14)
+	x0 = x0 ^ bits.RotateLeft32(x1, 1) ^ bits.RotateLeft32(x2, 17) ^ bits.RotateLeft32(x3, 14)
+	x0 = sub32(x0, &isb)
+	x1 = sub32(x1, &isb)
+	x2 = sub32(x2, &isb)
+	x3 = sub32(x3, &isb)
+	x[0], x[1], x[2], x[3] = x0^le.Uint32(key[0:]), x1^le.Uint32(key[4:]), x2^le.Uint32(key[8:]), x3^le.Uint32(key[12:])
+}
+
+// sublin32 sets x to Lin384(S(x)) ^ key.
+func sublin32(x *[8]uint32, key []byte) {
+	_ = key[31]
+	x0, x1, x2, x3, x4, x5, x6, x7 := x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]
+	x0 = sub32(x0, &sb)
+	x1 = sub32(x1, &sb)
+	x2 = sub32(x2, &sb)
+	x3 = sub32(x3, &sb)
+	x4 = sub32(x4, &sb)
+	x5 = sub32(x5, &sb)
+	x6 = sub32(x6, &sb)
+	x7 = sub32(x7, &sb)
+	x0 = x0 ^ bits.RotateLeft32(x1, 3) ^ bits.RotateLeft32(x2, 5) ^ bits.RotateLeft32(x3, 11) ^
+		bits.RotateLeft32(x4, 21) ^ bits.RotateLeft32(x5, 16) ^ bits.RotateLeft32(x6, 30) ^ bits.RotateLeft32(x7, 19)
+	x1 = x1 ^ bits.RotateLeft32(x2, 3) ^ bits.RotateLeft32(x3, 5) ^ bits.RotateLeft32(x4, 11) ^
+		bits.RotateLeft32(x5, 21) ^ bits.RotateLeft32(x6, 16) ^ bits.RotateLeft32(x7, 30) ^ bits.RotateLeft32(x0, 19)
+	x2 = x2 ^ bits.RotateLeft32(x3, 3) ^ bits.RotateLeft32(x4, 5) ^ bits.RotateLeft32(x5, 11) ^
+		bits.RotateLeft32(x6, 21) ^ bits.RotateLeft32(x7, 16) ^ bits.RotateLeft32(x0, 30) ^ bits.RotateLeft32(x1, 19)
+	x3 = x3 ^ bits.RotateLeft32(x4, 3) ^ bits.RotateLeft32(x5, 5) ^ bits.RotateLeft32(x6, 11) ^
+		bits.RotateLeft32(x7, 21) ^ bits.RotateLeft32(x0, 16) ^ bits.RotateLeft32(x1, 30) ^ bits.RotateLeft32(x2, 19)
+	x4 = x4 ^ bits.RotateLeft32(x5, 3) ^ bits.RotateLeft32(x6, 5) ^ bits.RotateLeft32(x7, 11) ^
+		bits.RotateLeft32(x0, 21) ^ bits.RotateLeft32(x1, 16) ^ bits.RotateLeft32(x2, 30) ^ bits.RotateLeft32(x3, 19)
+	x5 = x5 ^ bits.RotateLeft32(x6, 3) ^ bits.RotateLeft32(x7, 5) ^ bits.RotateLeft32(x0, 11) ^
+		bits.RotateLeft32(x1, 21) ^ bits.RotateLeft32(x2, 16) ^ bits.RotateLeft32(x3, 30) ^ bits.RotateLeft32(x4, 19)
+	x6 = x6 ^ bits.RotateLeft32(x7, 3) ^ bits.RotateLeft32(x0, 5) ^ bits.RotateLeft32(x1, 11) ^
+		bits.RotateLeft32(x2, 21) ^ bits.RotateLeft32(x3, 16) ^ bits.RotateLeft32(x4, 30) ^ bits.RotateLeft32(x5, 19)
+	x7 = x7 ^ bits.RotateLeft32(x0, 3) ^ bits.RotateLeft32(x1, 5) ^ bits.RotateLeft32(x2, 11) ^
+		bits.RotateLeft32(x3, 21) ^ bits.RotateLeft32(x4, 16) ^ bits.RotateLeft32(x5, 30) ^ bits.RotateLeft32(x6, 19)
+	x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7] = x0^le.Uint32(key[0:]), x1^le.Uint32(key[4:]), x2^le.Uint32(key[8:]), x3^le.Uint32(key[12:]), x4^le.Uint32(key[16:]), x5^le.Uint32(key[20:]), x6^le.Uint32(key[24:]), x7^le.Uint32(key[28:])
+}
+
+// invsublin32 sets x to S^-1(Ilin384(x)) ^ key.
+func invsublin32(x *[8]uint32, key []byte) {
+	_ = key[31]
+	x0, x1, x2, x3, x4, x5, x6, x7 := x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]
+	x7 = x7 ^ bits.RotateLeft32(x0, 3) ^ bits.RotateLeft32(x1, 5) ^ bits.RotateLeft32(x2, 11) ^
+		bits.RotateLeft32(x3, 21) ^ bits.RotateLeft32(x4, 16) ^ bits.RotateLeft32(x5, 30) ^ bits.RotateLeft32(x6, 19)
+	x6 = x6 ^ bits.RotateLeft32(x7, 3) ^ bits.RotateLeft32(x0, 5) ^ bits.RotateLeft32(x1, 11) ^
+		bits.RotateLeft32(x2, 21) ^ bits.RotateLeft32(x3, 16) ^ bits.RotateLeft32(x4, 30) ^ bits.RotateLeft32(x5, 19)
+	x5 = x5 ^ bits.RotateLeft32(x6, 3) ^ bits.RotateLeft32(x7, 5) ^ bits.RotateLeft32(x0, 11) ^
+		bits.RotateLeft32(x1, 21) ^ bits.RotateLeft32(x2, 16) ^ bits.RotateLeft32(x3, 30) ^ bits.RotateLeft32(x4, 19)
+	x4 = x4 ^ bits.RotateLeft32(x5, 3) ^ bits.RotateLeft32(x6, 5) ^ bits.RotateLeft32(x7, 11) ^
+		bits.RotateLeft32(x0, 21) ^ bits.RotateLeft32(x1, 16) ^ bits.RotateLeft32(x2, 30) ^ bits.RotateLeft32(x3, 19)
+	x3 = x3 ^ bits.RotateLeft32(x4, 3) ^ bits.RotateLeft32(x5, 5) ^ bits.RotateLeft32(x6, 11) ^
+		bits.RotateLeft32(x7, 21) ^ bits.RotateLeft32(x0, 16) ^ bits.RotateLeft32(x1, 30) ^ bits.RotateLeft32(x2, 19)
+	x2 = x2 ^ bits.RotateLeft32(x3, 3) ^ bits.RotateLeft32(x4, 5) ^ bits.RotateLeft32(x5, 11) ^
+		bits.RotateLeft32(x6, 21) ^ bits.RotateLeft32(x7, 16) ^ bits.RotateLeft32(x0, 30) ^ bits.RotateLeft32(x1, 19)
+	x1 = x1 ^ bits.RotateLeft32(x2, 3) ^ bits.RotateLeft32(x3, 5) ^ bits.RotateLeft32(x4, 11) ^
+		bits.RotateLeft32(x5, 21) ^ bits.RotateLeft32(x6, 16) ^ bits.RotateLeft32(x7, 30) ^ bits.RotateLeft32(x0, 19)
+	x0 = x0 ^ bits.RotateLeft32(x1, 3) ^ bits.RotateLeft32(x2, 5) ^ bits.RotateLeft32(x3, 11) ^
+		bits.RotateLeft32(x4, 21) ^ bits.RotateLeft32(x5, 16) ^ bits.RotateLeft32(x6, 30) ^ bits.RotateLeft32(x7, 19)
+	x0 = sub32(x0, &isb)
+	x1 = sub32(x1, &isb)
+	x2 = sub32(x2, &isb)
+	x3 = sub32(x3, &isb)
+	x4 = sub32(x4, &isb)
+	x5 = sub32(x5, &isb)
+	x6 = sub32(x6, &isb)
+	x7 = sub32(x7, &isb)
+	x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7] = x0^le.Uint32(key[0:]), x1^le.Uint32(key[4:]), x2^le.Uint32(key[8:]), x3^le.Uint32(key[12:]), x4^le.Uint32(key[16:]), x5^le.Uint32(key[20:]), x6^le.Uint32(key[24:]), x7^le.Uint32(key[28:])
+}
+
+// sublin64 sets x to Lin388(S(x)) ^ key.
+func sublin64(x *[8]uint64, key []byte) {
+	_ = key[63]
+	x0, x1, x2, x3, x4, x5, x6, x7 := x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]
+	x0 = sub64(x0, &sb)
+	x1 = sub64(x1, &sb)
+	x2 = sub64(x2, &sb)
+	x3 = sub64(x3, &sb)
+	x4 = sub64(x4, &sb)
+	x5 = sub64(x5, &sb)
+	x6 = sub64(x6, &sb)
+	x7 = sub64(x7, &sb)
+	x0 = x0 ^ bits.RotateLeft64(x1, 4) ^ x2 ^ bits.RotateLeft64(x3, 22) ^
+		bits.RotateLeft64(x4, 27) ^ bits.RotateLeft64(x5, 47) ^ bits.RotateLeft64(x6, 4) ^ bits.RotateLeft64(x7, 61)
+	x1 = x1 ^ bits.RotateLeft64(x2, 4) ^ x3 ^ bits.RotateLeft64(x4, 22) ^
+		bits.RotateLeft64(x5, 27) ^ bits.RotateLeft64(x6, 47) ^ bits.RotateLeft64(x7, 4) ^ bits.RotateLeft64(x0, 61)
+	x2 = x2 ^ bits.RotateLeft64(x3, 4) ^ x4 ^ bits.RotateLeft64(x5, 22) ^
+		bits.RotateLeft64(x6, 27) ^ bits.RotateLeft64(x7, 47) ^ bits.RotateLeft64(x0, 4) ^ bits.RotateLeft64(x1, 61)
+	x3 = x3 ^ bits.RotateLeft64(x4, 4) ^ x5 ^ bits.RotateLeft64(x6, 22) ^
+		bits.RotateLeft64(x7, 27) ^ bits.RotateLeft64(x0, 47) ^ bits.RotateLeft64(x1, 4) ^ bits.RotateLeft64(x2, 61)
+	x4 = x4 ^ bits.RotateLeft64(x5, 4) ^ x6 ^ bits.RotateLeft64(x7, 22) ^
+		bits.RotateLeft64(x0, 27) ^ bits.RotateLeft64(x1, 47) ^ bits.RotateLeft64(x2, 4) ^ bits.RotateLeft64(x3, 61)
+	x5 = x5 ^ bits.RotateLeft64(x6, 4) ^ x7 ^ bits.RotateLeft64(x0, 22) ^
+		bits.RotateLeft64(x1, 27) ^ bits.RotateLeft64(x2, 47) ^ bits.RotateLeft64(x3, 4) ^ bits.RotateLeft64(x4, 61)
+	x6 = x6 ^ bits.RotateLeft64(x7, 4) ^ x0 ^ bits.RotateLeft64(x1, 22) ^
+		bits.RotateLeft64(x2, 27) ^ bits.RotateLeft64(x3, 47) ^ bits.RotateLeft64(x4, 4) ^ bits.RotateLeft64(x5, 61)
+	x7 = x7 ^ bits.RotateLeft64(x0, 4) ^ x1 ^ bits.RotateLeft64(x2, 22) ^
+		bits.RotateLeft64(x3, 27) ^ bits.RotateLeft64(x4, 47) ^ bits.RotateLeft64(x5, 4) ^ bits.RotateLeft64(x6, 61)
+	x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7] = x0^le.Uint64(key[0:]), x1^le.Uint64(key[8:]), x2^le.Uint64(key[16:]), x3^le.Uint64(key[24:]), x4^le.Uint64(key[32:]), x5^le.Uint64(key[40:]), x6^le.Uint64(key[48:]), x7^le.Uint64(key[56:])
+}
+
+// invsublin64 sets x to S^-1(Ilin388(x)) ^ key.
+func invsublin64(x *[8]uint64, key []byte) {
+	_ = key[63]
+	x0, x1, x2, x3, x4, x5, x6, x7 := x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7]
+	x7 = x7 ^ bits.RotateLeft64(x0, 4) ^ x1 ^ bits.RotateLeft64(x2, 22) ^
+		bits.RotateLeft64(x3, 27) ^ bits.RotateLeft64(x4, 47) ^ bits.RotateLeft64(x5, 4) ^ bits.RotateLeft64(x6, 61)
+	x6 = x6 ^ bits.RotateLeft64(x7, 4) ^ x0 ^ bits.RotateLeft64(x1, 22) ^
+		bits.RotateLeft64(x2, 27) ^ bits.RotateLeft64(x3, 47) ^ bits.RotateLeft64(x4, 4) ^ bits.RotateLeft64(x5, 61)
+	x5 = x5 ^ bits.RotateLeft64(x6, 4) ^ x7 ^ bits.RotateLeft64(x0, 22) ^
+		bits.RotateLeft64(x1, 27) ^ bits.RotateLeft64(x2, 47) ^ bits.RotateLeft64(x3, 4) ^ bits.RotateLeft64(x4, 61)
+	x4 = x4 ^ bits.RotateLeft64(x5, 4) ^ x6 ^ bits.RotateLeft64(x7, 22) ^
+		bits.RotateLeft64(x0, 27) ^ bits.RotateLeft64(x1, 47) ^ bits.RotateLeft64(x2, 4) ^ bits.RotateLeft64(x3, 61)
+	x3 = x3 ^ bits.RotateLeft64(x4, 4) ^ x5 ^ bits.RotateLeft64(x6, 22) ^
+		bits.RotateLeft64(x7, 27) ^ bits.RotateLeft64(x0, 47) ^ bits.RotateLeft64(x1, 4) ^ bits.RotateLeft64(x2, 61)
+	x2 = x2 ^ bits.RotateLeft64(x3, 4) ^ x4 ^ bits.RotateLeft64(x5, 22) ^
+		bits.RotateLeft64(x6, 27) ^ bits.RotateLeft64(x7, 47) ^ bits.RotateLeft64(x0, 4) ^ bits.RotateLeft64(x1, 61)
+	x1 = x1 ^ bits.RotateLeft64(x2, 4) ^ x3 ^ bits.RotateLeft64(x4, 22) ^
+		bits.RotateLeft64(x5, 27) ^ bits.RotateLeft64(x6, 47) ^ bits.RotateLeft64(x7, 4) ^ bits.RotateLeft64(x0, 61)
+	x0 = x0 ^ bits.RotateLeft64(x1, 4) ^ x2 ^ bits.RotateLeft64(x3, 22) ^
+		bits.RotateLeft64(x4, 27) ^ bits.RotateLeft64(x5, 47) ^ bits.RotateLeft64(x6, 4) ^ bits.RotateLeft64(x7, 61)
+	x0 = sub64(x0, &isb)
+	x1 = sub64(x1, &isb)
+	x2 = sub64(x2, &isb)
+	x3 = sub64(x3, &isb)
+	x4 = sub64(x4, &isb)
+	x5 = sub64(x5, &isb)
+	x6 = sub64(x6, &isb)
+	x7 = sub64(x7, &isb)
+	x[0], x[1], x[2], x[3], x[4], x[5], x[6], x[7] = x0^le.Uint64(key[0:]), x1^le.Uint64(key[8:]), x2^le.Uint64(key[16:]), x3^le.Uint64(key[24:]), x4^le.Uint64(key[32:]), x5^le.Uint64(key[40:]), x6^le.Uint64(key[48:]), x7^le.Uint64(key[56:])
+}
+
+func (k *ExpandedKey) encrypt16(dst, src []byte) {
+	const blen = 16
+	var block [blen]byte
+	var x [4]uint32
+	rk := k.rk
+	addWords(block[:], src[:blen], rk[:blen])
+	for i := range x {
+		x[i] = le.Uint32(block[4*i:])
+	}
+	for r := 1; r < k.rounds-1; r++ {
+		sublin16(&x, rk[r*blen:r*blen+blen])
+	}
+	sublin16(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint32(block[4*i:], x[i])
+	}
+	addWords(dst[:blen], block[:], rk[(k.rounds-1)*blen:])
+}
+
+func (k *ExpandedKey) decrypt16(dst, src []byte) {
+	const blen = 16
+	var block [blen]byte
+	var x [4]uint32
+	rk := k.rk
+	subWords(block[:], src[:blen], rk[(k.rounds-1)*blen:])
+	for i := range x {
+		x[i] = le.Uint32(block[4*i:])
+	}
+	for r := k.rounds - 2; r > 0; r-- {
+		invsublin16(&x, rk[r*blen:r*blen+blen])
+	}
+	invsublin16(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint32(block[4*i:], x[i])
+	}
+	subWords(dst[:blen], block[:], rk[:blen])
+}
+
+func (k *ExpandedKey) encrypt32(dst, src []byte) {
+	const blen = 32
+	var block [blen]byte
+	var x [8]uint32
+	rk := k.rk
+	addWords(block[:], src[:blen], rk[:blen])
+	for i := range x {
+		x[i] = le.Uint32(block[4*i:])
+	}
+	for r := 1; r < k.rounds-1; r++ {
+		sublin32(&x, rk[r*blen:r*blen+blen])
+	}
+	sublin32(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint32(block[4*i:], x[i])
+	}
+	addWords(dst[:blen], block[:], rk[(k.rounds-1)*blen:])
+}
+
+func (k *ExpandedKey) decrypt32(dst, src []byte) {
+	const blen = 32
+	var block [blen]byte
+	var x [8]uint32
+	rk := k.rk
+	subWords(block[:], src[:blen], rk[(k.rounds-1)*blen:])
+	for i := range x {
+		x[i] = le.Uint32(block[4*i:])
+	}
+	for r := k.rounds - 2; r > 0; r-- {
+		invsublin32(&x, rk[r*blen:r*blen+blen])
+	}
+	invsublin32(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint32(block[4*i:], x[i])
+	}
+	subWords(dst[:blen], block[:], rk[:blen])
+}
+
+func (k *ExpandedKey) encrypt64(dst, src []byte) {
+	const blen = 64
+	var block [blen]byte
+	var x [8]uint64
+	rk := k.rk
+	addWords(block[:], src[:blen], rk[:blen])
+	for i := range x {
+		x[i] = le.Uint64(block[8*i:])
+	}
+	for r := 1; r < k.rounds-1; r++ {
+		sublin64(&x, rk[r*blen:r*blen+blen])
+	}
+	sublin64(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint64(block[8*i:], x[i])
+	}
+	addWords(dst[:blen], block[:], rk[(k.rounds-1)*blen:])
+}
+
+func (k *ExpandedKey) decrypt64(dst, src []byte) {
+	const blen = 64
+	var block [blen]byte
+	var x [8]uint64
+	rk := k.rk
+	subWords(block[:], src[:blen], rk[(k.rounds-1)*blen:])
+	for i := range x {
+		x[i] = le.Uint64(block[8*i:])
+	}
+	for r := k.rounds - 2; r > 0; r-- {
+		invsublin64(&x, rk[r*blen:r*blen+blen])
+	}
+	invsublin64(&x, noRoundKey[:blen])
+	for i := range x {
+		le.PutUint64(block[8*i:], x[i])
+	}
+	subWords(dst[:blen], block[:], rk[:blen])
+}
@@ -0,0 +1,186 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func mustExpand(t testing.TB, key []byte, blen int) *ExpandedKey {
+	t.Helper()
+	k, err := NewKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := k.Expand(blen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestKeyValidation(t *testing.T) {
+	for _, klen := range []int{0, 16, 31, 40, MAXKEYLEN + KEYLENSTEP} {
+		var want KeySizeError
+		if _, err := NewKey(make([]byte, klen)); !errors.As(err, &want) {
+			t.Errorf("NewKey(%d bytes): err = %v, want KeySizeError", klen, err)
+		}
+	}
+	if _, err := NewExpandedKey(Key{}, BLOCKLEN); err == nil {
+		t.Error("NewExpandedKey accepted the zero Key")
+	}
+	k, err := NewKey(katKey(DEFAULT_KEY_LEN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blen := range []int{0, 8, 24, 128} {
+		var want BlockSizeError
+		if _, err := k.Expand(blen); !errors.As(err, &want) {
+			t.Errorf("Expand(%d): err = %v, want BlockSizeError", blen, err)
+		}
+	}
+
+	e, err := k.Expand(BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.KeyLen() != DEFAULT_KEY_LEN || e.BlockSize() != BLOCKLEN {
+		t.Fatalf("KeyLen %d, BlockSize %d", e.KeyLen(), e.BlockSize())
+	}
+	var _ cipher.Block = e
+	e.Wipe()
+	defer func() {
+		if recover() == nil {
+			t.Error("Encrypt with a wiped key did not panic")
+		}
+	}()
+	block := make([]byte, BLOCKLEN)
+	e.Encrypt(block, block)
+}
+
+// refEncrypt and refDecrypt are the byte-wise rounds Encrypt and DecryptOFB
+// ran before they moved onto ExpandedKey, kept as the reference for it.
+func refEncrypt(data, rkey []uint8, klen int, blen int, res []uint8) {
+	var block, block2 Block
+
+	AddRk(data, rkey, 0, blen, block[:])
+	sBox(block[:], block2[:], blen, sb[:])
+	LinOp(&block2, &block, blen)
+
+	nr := int(RNDS(uint32(klen)))
+	for i := 1; i < nr-1; i++ {
+		AddRkX(block[:], rkey, i, blen, block2[:])
+		sBox(block2[:], block2[:], blen, sb[:])
+		LinOp(&block2, &block, blen)
+	}
+	AddRk(block[:], rkey, nr-1, blen, res)
+}
+
+func refDecrypt(data []uint8, rkey []uint8, klen int, blen int, res []uint8) {
+	var block, block2 Block
+
+	copy(block[:], InvAddRk(data, rkey, int(RNDS(uint32(klen))-1), blen))
+	for i := int(RNDS(uint32(klen))) - 2; i > 0; i-- {
+		InvlinOp(&block, &block2, blen)
+		InvsBox(block2[:], block2[:], blen)
+		AddRkX(block2[:], rkey, i, blen, block[:])
+	}
+	InvlinOp(&block, &block2, blen)
+	InvsBox(block2[:], block2[:], blen)
+	out := InvAddRk(block2[:], rkey, 0, blen)
+	copy(res, out)
+}
+
+// TestExpandedKeyMatchesReference checks ExpandedKey and the Encrypt and
+// DecryptOFB wrappers against the byte-wise rounds for every key and block
+// length.
+func TestExpandedKeyMatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for klen := MINKEYLEN; klen <= MAXKEYLEN; klen += KEYLENSTEP {
+		for _, blen := range []int{16, 32, 64} {
+			key := make([]byte, klen)
+			rng.Read(key)
+			rkey := expand(key, blen)
+			k := mustExpand(t, key, blen)
+			in := make([]byte, blen)
+			want := make([]byte, blen)
+			got := make([]byte, blen)
+			for i := 0; i < 200; i++ {
+				rng.Read(in)
+				if i == 0 {
+					clear(in)
+				} else if i == 1 {
+					copy(in, bytes.Repeat([]byte{0xff}, blen))
+				}
+				refEncrypt(in, rkey, klen, blen, want)
+				k.Encrypt(got, in)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("klen=%d blen=%d: encrypt %x = %x, want %x", klen, blen, in, got, want)
+				}
+				Encrypt(in, rkey, klen, blen, got)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("klen=%d blen=%d: Encrypt %x = %x, want %x", klen, blen, in, got, want)
+				}
+				refDecrypt(in, rkey, klen, blen, want)
+				k.Decrypt(got, in)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("klen=%d blen=%d: decrypt %x = %x, want %x", klen, blen, in, got, want)
+				}
+				DecryptOFB(in, rkey, klen, blen, got)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("klen=%d blen=%d: DecryptOFB %x = %x, want %x", klen, blen, in, got, want)
+				}
+			}
+			k.Wipe()
+		}
+	}
+}
+
+// BenchmarkExpandedKeyEncrypt and BenchmarkExpandedKeyDecrypt run the
+// byte-wise reference rounds next to ExpandedKey on the same key and block.
+func BenchmarkExpandedKeyEncrypt(b *testing.B) {
+	for _, blen := range []int{16, 32, 64} {
+		rkey := expand(katKey(DEFAULT_KEY_LEN), blen)
+		b.Run(fmt.Sprintf("blen=%d/reference", blen), func(b *testing.B) {
+			block := katPlain(blen)
+			b.SetBytes(int64(blen))
+			for i := 0; i < b.N; i++ {
+				refEncrypt(block, rkey, DEFAULT_KEY_LEN, blen, block)
+			}
+		})
+		b.Run(fmt.Sprintf("blen=%d/expanded", blen), func(b *testing.B) {
+			k := mustExpand(b, katKey(DEFAULT_KEY_LEN), blen)
+			defer k.Wipe()
+			block := katPlain(blen)
+			b.SetBytes(int64(blen))
+			for i := 0; i < b.N; i++ {
+				k.Encrypt(block, block)
+			}
+		})
+	}
+}
+
+func BenchmarkExpandedKeyDecrypt(b *testing.B) {
+	for _, blen := range []int{16, 32, 64} {
+		rkey := expand(katKey(DEFAULT_KEY_LEN), blen)
+		b.Run(fmt.Sprintf("blen=%d/reference", blen), func(b *testing.B) {
+			block := katPlain(blen)
+			b.SetBytes(int64(blen))
+			for i := 0; i < b.N; i++ {
+				refDecrypt(block, rkey, DEFAULT_KEY_LEN, blen, block)
+			}
+		})
+		b.Run(fmt.Sprintf("blen=%d/expanded", blen), func(b *testing.B) {
+			k := mustExpand(b, katKey(DEFAULT_KEY_LEN), blen)
+			defer k.Wipe()
+			block := katPlain(blen)
+			b.SetBytes(int64(blen))
+			for i := 0; i < b.N; i++ {
+				k.Decrypt(block, block)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package qalqan
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzReadHeader(f *testing.F) {
+	var buf bytes.Buffer
+	WriteHeader(&buf, CreateFileMetadata(1, 0, DEFAULT_KEY_LEN, 0x77, 0x01, 0, 7, byte(ModeOFB)), "a.txt", 5)
+	f.Add(buf.Bytes())
+	f.Add(make([]byte, 16))
+	f.Add(make([]byte, 26))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		meta, name, size, n, err := ReadHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if n > len(data) {
+			t.Fatalf("header length %d exceeds input length %d", n, len(data))
+		}
+		if clean, err := sanitizeName(name); err != nil || clean != name {
+			return
+		}
+		var out bytes.Buffer
+		if err := WriteHeader(&out, meta, name, size); err != nil {
+			t.Fatal(err)
+		}
+		meta2, name2, size2, _, err := ReadHeader(&out)
+		if err != nil || meta2 != meta || name2 != name || size2 != size {
+			t.Fatalf("header does not round-trip: %q %d -> %q %d (%v)", name, size, name2, size2, err)
+		}
+	})
+}
+
+func FuzzMyremove(f *testing.F) {
+	f.Add(make([]byte, BLOCKLEN))
+	f.Add(mustHex(f, "11111111111111111111118000000001"))
+	f.Add(mustHex(f, "00000000000000000000000000000081"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var block [BLOCKLEN]byte
+		copy(block[:], data)
+		n := Myremove(&block)
+		if n < 0 || n > BLOCKLEN {
+			t.Fatalf("Myremove = %d", n)
+		}
+		if n == BLOCKLEN {
+			return
+		}
+		var padded [BLOCKLEN]byte
+		copy(padded[:], block[:n])
+		myappend(padded[:], n)
+		if got := Myremove(&padded); got != n {
+			t.Fatalf("Myremove(myappend(%d)) = %d", n, got)
+		}
+	})
+}
+
+func FuzzDecryptOFB_File(f *testing.F) {
+	rkey := expand(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	iv := katPlain(BLOCKLEN)
+	for _, v := range ofbKAT {
+		f.Add(mustHex(f, v.ciphertext))
+	}
+	f.Add([]byte{1, 2, 3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var pt bytes.Buffer
+		err := DecryptOFB_File(len(data), rkey, DEFAULT_KEY_LEN, iv, bytes.NewReader(data), &pt)
+		if len(data)%BLOCKLEN != 0 {
+			if err == nil {
+				t.Fatalf("accepted ciphertext of length %d", len(data))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt.Len() > len(data) || len(data)-pt.Len() > BLOCKLEN {
+			t.Fatalf("plaintext length %d for ciphertext length %d", pt.Len(), len(data))
+		}
+		var ct bytes.Buffer
+		if err := EncryptOFB_File(pt.Len(), rkey, DEFAULT_KEY_LEN, iv, bytes.NewReader(pt.Bytes()), &ct); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ct.Bytes()[:pt.Len()], data[:pt.Len()]) {
+			t.Fatal("re-encryption does not reproduce the ciphertext prefix")
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+)
+
+// MAC computes the Qalqan imitovstavka incrementally and implements
+// hash.Hash. For the same key and data its tag equals Qalqan_Imit.
+type MAC struct {
+	b      cipher.Block
+	acc    [BLOCKLEN]byte
+	buf    [BLOCKLEN]byte
+	n      int
+	blocks uint64
+}
+
+// NewMAC returns a MAC keyed by b, which must have a BLOCKLEN block size.
+func NewMAC(b cipher.Block) (*MAC, error) {
+	if b.BlockSize() != BLOCKLEN {
+		return nil, BlockSizeError(b.BlockSize())
+	}
+	return &MAC{b: b}, nil
+}
+
+func (m *MAC) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		k := copy(m.buf[m.n:], p)
+		m.n += k
+		p = p[k:]
+		if m.n == BLOCKLEN {
+			for i := 0; i < BLOCKLEN; i++ {
+				m.acc[i] ^= m.buf[i]
+			}
+			m.b.Encrypt(m.acc[:], m.acc[:])
+			m.n = 0
+			m.blocks++
+		}
+	}
+	return written, nil
+}
+
+// Sum appends the tag to in without changing the MAC state.
+func (m *MAC) Sum(in []byte) []byte {
+	acc := m.acc
+	switch {
+	case m.n > 0:
+		buf := m.buf
+		myappend(buf[:], m.n)
+		for i := 0; i < BLOCKLEN; i++ {
+			acc[i] ^= buf[i]
+		}
+		m.b.Encrypt(acc[:], acc[:])
+	case m.blocks == 0:
+		m.b.Encrypt(acc[:], acc[:])
+	}
+	return append(in, acc[:]...)
+}
+
+func (m *MAC) Reset() {
+	m.acc = [BLOCKLEN]byte{}
+	m.buf = [BLOCKLEN]byte{}
+	m.n = 0
+	m.blocks = 0
+}
+
+func (m *MAC) Size() int { return BLOCKLEN }
+
+func (m *MAC) BlockSize() int { return BLOCKLEN }
@@ -0,0 +1,177 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+/*
+Key files written since version 1 start with a 32 byte header:
+
+* 0 - 3   - magic "QLQK";
+* 4       - format version;
+* 5       - KDF: 0x01 - Argon2id;
+* 6       - key length;
+* 7       - Argon2 threads;
+* 8 - 11  - Argon2 passes, little-endian;
+* 12 - 15 - Argon2 memory in KiB, little-endian;
+* 16 - 31 - salt;
+* 32 - 47 - password check: imit of bytes 0 - 31 under the unlock key.
+
+The header is covered by the key file imit. Files without the magic are
+legacy files unlocked with Hash512.
+*/
+
+const (
+	KeyFileLegacy = 0
+	KeyFileV1     = 1
+
+	KDFHash512  = 0x00
+	KDFArgon2id = 0x01
+
+	KeyFileHeaderLen = 48
+	kdfSaltLen       = 16
+
+	// The limits keep a damaged or crafted header from making LoadKeySet
+	// spend minutes or gigabytes before the password is checked.
+	// NewKeyFileHeader uses 3 passes over 64 MiB.
+	maxArgon2Time   = 64
+	maxArgon2Memory = 1 << 20 // KiB
+)
+
+var keyFileMagic = []byte("QLQK")
+
+// KeyFileHeader describes how the password of a key file is turned into the
+// key that protects it.
+type KeyFileHeader struct {
+	Version int
+	KDF     byte
+	KeyLen  int
+	Threads uint8
+	Time    uint32
+	Memory  uint32
+	Salt    [kdfSaltLen]byte
+	Check   [BLOCKLEN]byte
+}
+
+// NewKeyFileHeader returns a current-version header for klen byte keys with
+// default Argon2id parameters and a fresh random salt.
+func NewKeyFileHeader(klen int) (*KeyFileHeader, error) {
+	if err := checkKeyLen(klen); err != nil {
+		return nil, err
+	}
+	h := &KeyFileHeader{
+		Version: KeyFileV1,
+		KDF:     KDFArgon2id,
+		KeyLen:  klen,
+		Threads: 4,
+		Time:    3,
+		Memory:  64 * 1024,
+	}
+	if _, err := rand.Read(h.Salt[:]); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	return h, nil
+}
+
+// ParseKeyFileHeader reads the header at the start of a key file and
+// returns it with the remaining data. Legacy files have no header; they get
+// a header with Version KeyFileLegacy and the data is returned unchanged.
+func ParseKeyFileHeader(data []byte) (*KeyFileHeader, []byte, error) {
+	if !bytes.HasPrefix(data, keyFileMagic) {
+		return &KeyFileHeader{Version: KeyFileLegacy, KDF: KDFHash512}, data, nil
+	}
+	if len(data) < KeyFileHeaderLen {
+		return nil, nil, fmt.Errorf("key file header: %w", ErrTruncated)
+	}
+	h := &KeyFileHeader{
+		Version: int(data[4]),
+		KDF:     data[5],
+		KeyLen:  int(data[6]),
+		Threads: data[7],
+		Time:    binary.LittleEndian.Uint32(data[8:12]),
+		Memory:  binary.LittleEndian.Uint32(data[12:16]),
+	}
+	copy(h.Salt[:], data[16:32])
+	copy(h.Check[:], data[32:KeyFileHeaderLen])
+
+	if h.Version != KeyFileV1 {
+		return nil, nil, fmt.Errorf("%w: key file version %d", ErrUnsupportedVersion, h.Version)
+	}
+	if h.KDF != KDFArgon2id {
+		return nil, nil, fmt.Errorf("%w: key file KDF 0x%02X", ErrUnsupportedVersion, h.KDF)
+	}
+	if err := checkKeyLen(h.KeyLen); err != nil {
+		return nil, nil, err
+	}
+	if h.Threads == 0 || h.Time == 0 || h.Time > maxArgon2Time ||
+		h.Memory < 8*uint32(h.Threads) || h.Memory > maxArgon2Memory {
+		return nil, nil, fmt.Errorf("invalid Argon2 parameters t=%d m=%d p=%d", h.Time, h.Memory, h.Threads)
+	}
+	return h, data[KeyFileHeaderLen:], nil
+}
+
+// MarshalBinary encodes the header. Legacy headers encode to nothing.
+func (h *KeyFileHeader) MarshalBinary() ([]byte, error) {
+	if h.Version == KeyFileLegacy {
+		return nil, nil
+	}
+	if h.Version != KeyFileV1 {
+		return nil, fmt.Errorf("%w: key file version %d", ErrUnsupportedVersion, h.Version)
+	}
+	b := h.params()
+	return append(b, h.Check[:]...), nil
+}
+
+// params encodes the header without the password check.
+func (h *KeyFileHeader) params() []byte {
+	b := make([]byte, 32, KeyFileHeaderLen)
+	copy(b, keyFileMagic)
+	b[4] = byte(h.Version)
+	b[5] = h.KDF
+	b[6] = byte(h.KeyLen)
+	b[7] = h.Threads
+	binary.LittleEndian.PutUint32(b[8:12], h.Time)
+	binary.LittleEndian.PutUint32(b[12:16], h.Memory)
+	copy(b[16:], h.Salt[:])
+	return b
+}
+
+// UnlockKey derives the DEFAULT_KEY_LEN byte key that encrypts the keys in
+// the file. The caller releases it.
+func (h *KeyFileHeader) UnlockKey(password string) *SecureBuffer {
+	key := NewSecureBuffer(DEFAULT_KEY_LEN)
+	if h.Version == KeyFileLegacy {
+		sum := Hash512(password)
+		copy(key.Bytes(), sum[:])
+		clear(sum[:])
+		return key
+	}
+	pw := []byte(password)
+	derived := argon2.IDKey(pw, h.Salt[:], h.Time, h.Memory, h.Threads, DEFAULT_KEY_LEN)
+	copy(key.Bytes(), derived)
+	clear(derived)
+	clear(pw)
+	return key
+}
+
+// passwordCheck returns the Check value for the unlock key wrap.
+func (h *KeyFileHeader) passwordCheck(wrap cipher.Block) [BLOCKLEN]byte {
+	var check [BLOCKLEN]byte
+	m := &MAC{b: wrap}
+	m.Write(h.params())
+	copy(check[:], m.Sum(nil))
+	return check
+}
+
+func (h *KeyFileHeader) String() string {
+	if h.Version == KeyFileLegacy {
+		return "legacy key file (unsalted SHA-512)"
+	}
+	return fmt.Sprintf("v%d key file, Argon2id t=%d m=%d MiB p=%d", h.Version, h.Time, h.Memory/1024, h.Threads)
+}
@@ -0,0 +1,87 @@
+package qalqan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestKeyFileHeaderLegacy(t *testing.T) {
+	data := []byte("legacy key file body")
+	h, rest, err := ParseKeyFileHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != KeyFileLegacy || !bytes.Equal(rest, data) {
+		t.Fatalf("got version %d and %d bytes, want legacy and unchanged data", h.Version, len(rest))
+	}
+	if want := Hash512("secret"); !bytes.Equal(h.UnlockKey("secret").Bytes(), want[:]) {
+		t.Fatal("legacy unlock key differs from Hash512")
+	}
+}
+
+func TestKeyFileHeaderRoundTrip(t *testing.T) {
+	h, err := NewKeyFileHeader(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Time, h.Memory, h.Threads = 1, 64, 1
+
+	b, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, rest, err := ParseKeyFileHeader(append(b, 0xAA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *h || !bytes.Equal(rest, []byte{0xAA}) {
+		t.Fatalf("header does not round-trip: %+v != %+v", got, h)
+	}
+
+	other := *h
+	other.Salt[0] ^= 1
+	if bytes.Equal(h.UnlockKey("secret").Bytes(), other.UnlockKey("secret").Bytes()) {
+		t.Fatal("salt does not affect the unlock key")
+	}
+}
+
+func TestKeyFileHeaderArgon2KAT(t *testing.T) {
+	h := &KeyFileHeader{Version: KeyFileV1, KDF: KDFArgon2id, KeyLen: 32, Threads: 1, Time: 1, Memory: 64}
+	copy(h.Salt[:], katData(kdfSaltLen))
+	const want = "687fd5c9cb4e63b2237bbe7f1ae5ebd2c8018baf552e5c0252ba32a27f751638"
+	key := h.UnlockKey("password")
+	if got := hex.EncodeToString(key.Bytes()); got != want {
+		t.Fatalf("UnlockKey = %s, want %s", got, want)
+	}
+}
+
+func TestKeyFileHeaderRejects(t *testing.T) {
+	h, err := NewKeyFileHeader(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, _ := h.MarshalBinary()
+	for name, tc := range map[string]struct {
+		mutate func(b []byte) []byte
+		want   error
+	}{
+		"truncated": {func(b []byte) []byte { return b[:KeyFileHeaderLen-1] }, ErrTruncated},
+		"version":   {func(b []byte) []byte { b[4] = 9; return b }, ErrUnsupportedVersion},
+		"kdf":       {func(b []byte) []byte { b[5] = 0x7F; return b }, ErrUnsupportedVersion},
+		"key len":   {func(b []byte) []byte { b[6] = 33; return b }, nil},
+		"threads":   {func(b []byte) []byte { b[7] = 0; return b }, nil},
+		"memory":    {func(b []byte) []byte { b[15] = 0xFF; return b }, nil},
+		"1 GiB + 1": {func(b []byte) []byte { binary.LittleEndian.PutUint32(b[12:], 1<<20+1); return b }, nil},
+	} {
+		b := tc.mutate(append([]byte(nil), good...))
+		_, _, err := ParseKeyFileHeader(b)
+		if err == nil {
+			t.Errorf("%s: header accepted", name)
+		} else if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+}
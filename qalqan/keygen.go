@@ -0,0 +1,101 @@
+package qalqan
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+const (
+	CircleKeyCount     = 10
+	SessionKeysPerUser = 100
+	MaxKeySetUsers     = 255
+)
+
+// GenerateKeySet writes a new key file for users users with klen byte keys,
+// protected by password under a fresh Argon2id header.
+func GenerateKeySet(w io.Writer, password string, klen, users int) error {
+	hdr, err := NewKeyFileHeader(klen)
+	if err != nil {
+		return err
+	}
+	return WriteKeySet(w, hdr, password, users)
+}
+
+// WriteKeySet writes hdr followed by a random kikey, CircleKeyCount circle
+// keys and users×SessionKeysPerUser session keys, each encrypted block by
+// block under hdr.UnlockKey(password), and the imit of everything before it
+// keyed by the kikey. It fills in hdr.Check. The result loads with
+// LoadKeySet.
+func WriteKeySet(w io.Writer, hdr *KeyFileHeader, password string, users int) error {
+	if users < 1 || users > MaxKeySetUsers {
+		return fmt.Errorf("user count %d out of range 1..%d", users, MaxKeySetUsers)
+	}
+	klen := hdr.KeyLen
+	if err := checkKeyLen(klen); err != nil {
+		return err
+	}
+	unlockKey := hdr.UnlockKey(password)
+	wrap, err := NewCipher(unlockKey.Bytes(), BLOCKLEN)
+	unlockKey.Release()
+	if err != nil {
+		return err
+	}
+	defer wipeBlock(wrap)
+	if hdr.Version != KeyFileLegacy {
+		hdr.Check = hdr.passwordCheck(wrap)
+	}
+	header, err := hdr.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	mem := NewSecureBuffer(2 * klen)
+	defer mem.Release()
+	kikey, key := mem.Bytes()[:klen], mem.Bytes()[klen:]
+	if _, err := rand.Read(kikey); err != nil {
+		return fmt.Errorf("generate kikey: %w", err)
+	}
+	imitKey, err := NewCipher(kikey, BLOCKLEN)
+	if err != nil {
+		return err
+	}
+	defer wipeBlock(imitKey)
+	mac := &MAC{b: imitKey}
+
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, mac)
+	if _, err := out.Write(header); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+
+	enc := make([]byte, klen)
+	writeKey := func(k []byte) error {
+		for j := 0; j < klen; j += BLOCKLEN {
+			wrap.Encrypt(enc[j:j+BLOCKLEN], k[j:j+BLOCKLEN])
+		}
+		if _, err := out.Write(enc); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+		return nil
+	}
+
+	if err := writeKey(kikey); err != nil {
+		return err
+	}
+	clear(kikey)
+	for i := 0; i < CircleKeyCount+users*SessionKeysPerUser; i++ {
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("generate key: %w", err)
+		}
+		if err := writeKey(key); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.Write(mac.Sum(nil)); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,98 @@
+package qalqan
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func cheapHeader(t *testing.T, klen int) *KeyFileHeader {
+	t.Helper()
+	hdr, err := NewKeyFileHeader(klen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.Time, hdr.Memory, hdr.Threads = 1, 64, 1
+	return hdr
+}
+
+func writeKeySet(t *testing.T, hdr *KeyFileHeader, password string, users int) []byte {
+	t.Helper()
+	var file bytes.Buffer
+	if err := WriteKeySet(&file, hdr, password, users); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+func TestWriteKeySetLoads(t *testing.T) {
+	for _, klen := range []int{32, 80, 128} {
+		for _, hdr := range []*KeyFileHeader{cheapHeader(t, klen), {Version: KeyFileLegacy, KeyLen: klen}} {
+			data := writeKeySet(t, hdr, "secret", 3)
+			want := (1+CircleKeyCount+3*SessionKeysPerUser)*klen + BLOCKLEN
+			if hdr.Version != KeyFileLegacy {
+				want += KeyFileHeaderLen
+			}
+			if len(data) != want {
+				t.Fatalf("klen=%d: file is %d bytes, want %d", klen, len(data), want)
+			}
+
+			ks, err := LoadKeySet(bytes.NewReader(data), "secret")
+			if err != nil {
+				t.Fatalf("klen=%d version=%d: %v", klen, hdr.Version, err)
+			}
+			if ks.Users != 3 || ks.KeyLen != klen || ks.Header.Version != hdr.Version {
+				t.Fatalf("klen=%d: loaded %s", klen, ks)
+			}
+			if len(ks.Circle[9]) != klen || len(ks.Session[2][99]) != klen {
+				t.Fatalf("klen=%d: short keys", klen)
+			}
+			if bytes.Equal(ks.Session[0][0], ks.Session[0][1]) || bytes.Equal(ks.Circle[0], ks.Session[0][0]) {
+				t.Fatalf("klen=%d: keys repeat", klen)
+			}
+		}
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	good := writeKeySet(t, cheapHeader(t, 32), "secret", 2)
+	legacy := writeKeySet(t, &KeyFileHeader{Version: KeyFileLegacy, KeyLen: 32}, "secret", 2)
+
+	corrupt := append([]byte(nil), good...)
+	corrupt[len(corrupt)/2] ^= 1
+
+	noUsers := append([]byte(nil), good[:KeyFileHeaderLen+(1+CircleKeyCount)*32]...)
+	noUsers = append(noUsers, good[len(good)-BLOCKLEN:]...)
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		password string
+		want     []error
+	}{
+		{"wrong password", good, "guess", []error{ErrWrongPassword}},
+		{"legacy wrong password", legacy, "guess", []error{ErrWrongPassword, ErrMACMismatch}},
+		{"corrupted", corrupt, "secret", []error{ErrMACMismatch}},
+		{"truncated", good[:len(good)-1], "secret", []error{ErrTruncated}},
+		{"truncated header", good[:KeyFileHeaderLen-1], "secret", []error{ErrTruncated}},
+		{"legacy truncated", legacy[:len(legacy)-BLOCKLEN], "secret", []error{ErrTruncated}},
+		{"empty", nil, "secret", []error{ErrTruncated}},
+		{"no users", noUsers, "secret", []error{ErrBadUserCount}},
+	} {
+		_, err := LoadKeySet(bytes.NewReader(tc.data), tc.password)
+		for _, want := range tc.want {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: got %v, want %v", tc.name, err, want)
+			}
+		}
+	}
+}
+
+func TestWriteKeySetRejectsUserCount(t *testing.T) {
+	hdr := cheapHeader(t, 32)
+	for _, users := range []int{0, MaxKeySetUsers + 1} {
+		if err := WriteKeySet(new(bytes.Buffer), hdr, "secret", users); err == nil {
+			t.Errorf("users=%d accepted", users)
+		}
+	}
+}
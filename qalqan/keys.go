@@ -1,109 +1,195 @@
-/*
-_______________________________________________
-					All keys:				   |
-* [32] byte - Kikey;						   |
-* [10][32] byte - Circle key;				   |
-* [100][32] byte - Session key for count users;|
-* [16] byte - imit.							   |
-_______________________________________________|
-			16 byte data on files			   |
-* 0 - 0;									   |
-* 1 - user number;							   |
-* 2 - 0x04;									   |
-* 3 - 0x20;									   |
-* 4 - 0x77 - file,;						       |
-	  0x88 - photo,						       |
-	  0x66 - text (message),				   |
-	  0x55 - audio.							   |
-* 5 - circle or session key;				   |
-* 6 - circle number key;;					   |
-* 7 - session number key;;			           |
-* 8 - 15 - 0x00;							   |
-------------------------------------------------
-*/
-
-package qalqan
-
-import (
-	"bytes"
-	"crypto/sha512"
-	"fmt"
-)
-
-func Hash512(value string) [32]byte {
-	hash := []byte(value)
-	for i := 0; i < 1000; i++ {
-		sum := sha512.Sum512(hash)
-		hash = sum[:]
-	}
-	var hash32 [32]byte
-	copy(hash32[:], hash[:32])
-	return hash32
-}
-
-func LoadSessionKeys(data []byte, ostream *bytes.Buffer, rKey []byte, session_keys *[][100][32]byte) {
-	const perUser = 100 * DEFAULT_KEY_LEN
-
-	rem := ostream.Len()
-	if rem < BLOCKLEN {
-		fmt.Println("LoadSessionKeys: not enough data (no room for IMIT)")
-		return
-	}
-	sessBytes := rem - BLOCKLEN
-	if sessBytes%perUser != 0 {
-		fmt.Printf("LoadSessionKeys: malformed length: %d is not multiple of %d\n", sessBytes, perUser)
-		return
-	}
-	usr_cnt := sessBytes / perUser
-	if usr_cnt <= 0 || usr_cnt > 255 {
-		fmt.Printf("LoadSessionKeys: suspicious user count: %d\n", usr_cnt)
-		return
-	}
-
-	*session_keys = make([][100][32]byte, usr_cnt)
-
-	readSessionKey := make([]byte, DEFAULT_KEY_LEN)
-	for u := 0; u < usr_cnt; u++ {
-		for i := 0; i < 100; i++ {
-			n, err := ostream.Read(readSessionKey[:DEFAULT_KEY_LEN])
-			if err != nil {
-				fmt.Println("LoadSessionKeys: error reading session key:", err)
-				return
-			}
-			if n != DEFAULT_KEY_LEN {
-				fmt.Println("LoadSessionKeys: unexpected EOF in session key")
-				return
-			}
-			for j := 0; j < DEFAULT_KEY_LEN; j += BLOCKLEN {
-				DecryptOFB(readSessionKey[j:j+BLOCKLEN], rKey, DEFAULT_KEY_LEN, BLOCKLEN, readSessionKey[j:j+BLOCKLEN])
-			}
-			copy((*session_keys)[u][i][:], readSessionKey[:])
-		}
-	}
-}
-
-func LoadCircleKeys(data []byte, ostream *bytes.Buffer, rKey []byte, circle_keys *[10][32]byte) {
-	*circle_keys = [10][32]byte{}
-
-	if ostream.Len() < 10*DEFAULT_KEY_LEN {
-		fmt.Printf("LoadCircleKeys: not enough data for 10 circle keys (have %d)\n", ostream.Len())
-		return
-	}
-
-	readCircleKey := make([]byte, DEFAULT_KEY_LEN)
-	for i := 0; i < 10; i++ {
-		n, err := ostream.Read(readCircleKey[:DEFAULT_KEY_LEN])
-		if err != nil {
-			fmt.Printf("LoadCircleKeys: failed to read circle key %d: %v\n", i, err)
-			return
-		}
-		if n != DEFAULT_KEY_LEN {
-			fmt.Printf("LoadCircleKeys: unexpected EOF while reading circle key %d\n", i)
-			return
-		}
-		for j := 0; j < DEFAULT_KEY_LEN; j += BLOCKLEN {
-			DecryptOFB(readCircleKey[j:j+BLOCKLEN], rKey, DEFAULT_KEY_LEN, BLOCKLEN, readCircleKey[j:j+BLOCKLEN])
-		}
-		copy((*circle_keys)[i][:], readCircleKey[:])
-	}
-}
\ No newline at end of file
+/*
+_______________________________________________
+					All keys:				   |
+* [48] byte - header, v1 files only (kdf.go);  |
+* [klen] byte - Kikey;						   |
+* [10][klen] byte - Circle key;				   |
+* [100][klen] byte - Session key for count users;|
+* [16] byte - imit.							   |
+* klen - 32..128 in steps of 16.			   |
+_______________________________________________|
+			16 byte data on files			   |
+* 0 - 0;									   |
+* 1 - sender user number (1-based);			   |
+* 2 - 0x04;									   |
+* 3 - key length (0x20 for 32 byte keys);	   |
+* 4 - 0x77 - file,;						       |
+	  0x88 - photo,						       |
+	  0x66 - text (message),				   |
+	  0x55 - audio.							   |
+* 5 - circle or session key;				   |
+* 6 - circle number key;;					   |
+* 7 - session number key;;			           |
+* 8 - mode: 0x00 - OFB, 0x01 - ECB,		   |
+	  0x02 - CBC, 0x03 - CTR;			       |
+* 9 - recipient user number, 0 - all users;   |
+* 10 - 15 - 0x00;							   |
+------------------------------------------------
+*/
+
+package qalqan
+
+import (
+	"crypto/cipher"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"io"
+)
+
+func Hash512(value string) [32]byte {
+	hash := []byte(value)
+	for i := 0; i < 1000; i++ {
+		sum := sha512.Sum512(hash)
+		clear(hash)
+		hash = sum[:]
+	}
+	var hash32 [32]byte
+	copy(hash32[:], hash[:32])
+	clear(hash)
+	return hash32
+}
+
+// KeySet is a decrypted key file.
+type KeySet struct {
+	Header  *KeyFileHeader
+	KeyLen  int
+	Users   int
+	Circle  [CircleKeyCount][]byte
+	Session [][SessionKeysPerUser][]byte
+	ImitKey cipher.Block
+
+	kikey []byte
+	imit  [BLOCKLEN]byte
+	mem   *SecureBuffer
+}
+
+// LoadKeySet reads a key file, checks its imit and decrypts its keys. The
+// key length is taken from the header or, for legacy files, from the file
+// size. Errors wrap ErrTruncated, ErrBadUserCount, ErrWrongPassword or
+// ErrMACMismatch. Legacy files carry no password check, so a wrong password
+// for them is reported as ErrWrongPassword together with ErrMACMismatch.
+func LoadKeySet(r io.Reader, password string) (*KeySet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	hdr, klen, users, err := InspectKeyFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockKey := hdr.UnlockKey(password)
+	wrap, err := NewCipher(unlockKey.Bytes(), BLOCKLEN)
+	unlockKey.Release()
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBlock(wrap)
+	if hdr.Version != KeyFileLegacy {
+		if check := hdr.passwordCheck(wrap); subtle.ConstantTimeCompare(check[:], hdr.Check[:]) != 1 {
+			return nil, ErrWrongPassword
+		}
+	}
+
+	n := (1 + CircleKeyCount + users*SessionKeysPerUser) * klen
+	body := data[len(data)-BLOCKLEN-n:]
+	ks := &KeySet{Header: hdr, KeyLen: klen, Users: users}
+	ks.mem = NewSecureBuffer(n)
+	next := func(off int) []byte {
+		key := ks.mem.Bytes()[off : off+klen : off+klen]
+		for j := 0; j < klen; j += BLOCKLEN {
+			wrap.Decrypt(key[j:j+BLOCKLEN], body[off+j:off+j+BLOCKLEN])
+		}
+		return key
+	}
+
+	ks.kikey = next(0)
+	copy(ks.imit[:], data[len(data)-BLOCKLEN:])
+	if ks.ImitKey, err = NewCipher(ks.kikey, BLOCKLEN); err != nil {
+		ks.Wipe()
+		return nil, err
+	}
+	m := &MAC{b: ks.ImitKey}
+	m.Write(data[:len(data)-BLOCKLEN])
+	if subtle.ConstantTimeCompare(m.Sum(nil), data[len(data)-BLOCKLEN:]) != 1 {
+		ks.Wipe()
+		if hdr.Version == KeyFileLegacy {
+			return nil, fmt.Errorf("%w: %w", ErrWrongPassword, ErrMACMismatch)
+		}
+		return nil, ErrMACMismatch
+	}
+
+	off := klen
+	for i := range ks.Circle {
+		ks.Circle[i] = next(off)
+		off += klen
+	}
+	ks.Session = make([][SessionKeysPerUser][]byte, users)
+	for u := range ks.Session {
+		for i := range ks.Session[u] {
+			ks.Session[u][i] = next(off)
+			off += klen
+		}
+	}
+	return ks, nil
+}
+
+// InspectKeyFile returns the header, key length and user count of the key
+// file data without unlocking it.
+func InspectKeyFile(data []byte) (*KeyFileHeader, int, int, error) {
+	hdr, body, err := ParseKeyFileHeader(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	klen, users, err := keySetLayout(hdr, len(body)-BLOCKLEN)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return hdr, klen, users, nil
+}
+
+// keySetLayout returns the key length and user count for n bytes of keys.
+func keySetLayout(hdr *KeyFileHeader, n int) (klen, users int, err error) {
+	if hdr.Version != KeyFileLegacy {
+		return keySetUsers(hdr.KeyLen, n)
+	}
+	for k := MINKEYLEN; k <= MAXKEYLEN; k += KEYLENSTEP {
+		if n < (1+CircleKeyCount)*k || (n-(1+CircleKeyCount)*k)%(SessionKeysPerUser*k) != 0 {
+			continue
+		}
+		return keySetUsers(k, n)
+	}
+	return 0, 0, fmt.Errorf("%w: %d bytes of keys do not match any key length", ErrTruncated, max(n, 0))
+}
+
+func keySetUsers(klen, n int) (int, int, error) {
+	fixed := (1 + CircleKeyCount) * klen
+	perUser := SessionKeysPerUser * klen
+	if n < fixed {
+		return 0, 0, fmt.Errorf("%w: %d bytes of keys, need at least %d", ErrTruncated, max(n, 0), fixed+perUser)
+	}
+	if (n-fixed)%perUser != 0 {
+		return 0, 0, fmt.Errorf("%w: %d bytes of session keys is not a multiple of %d", ErrTruncated, n-fixed, perUser)
+	}
+	users := (n - fixed) / perUser
+	if users < 1 || users > MaxKeySetUsers {
+		return 0, 0, fmt.Errorf("%w: %d", ErrBadUserCount, users)
+	}
+	return klen, users, nil
+}
+
+// Wipe zeroes all keys of the set.
+func (ks *KeySet) Wipe() {
+	if ks.mem != nil {
+		ks.mem.Release()
+	}
+	if ks.ImitKey != nil {
+		wipeBlock(ks.ImitKey)
+	}
+}
+
+// String summarizes the key set for display.
+func (ks *KeySet) String() string {
+	return fmt.Sprintf("%d users, %d-byte keys, %s", ks.Users, ks.KeyLen, ks.Header)
+}
@@ -0,0 +1,274 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// KeyStore owns a loaded key set and hands out expanded keys as
+// cipher.Block. Session keys of the own user are consumed once; keys of any
+// user stay available for decryption. It is safe for concurrent use.
+//
+// Every key handed out is an expansion of its own, so Wipe cannot pull it
+// from under an operation that is still running; such keys are zeroed when
+// they are garbage collected.
+type KeyStore struct {
+	mu     sync.Mutex
+	set    *KeySet
+	user   int
+	ledger *Ledger
+	taken  [SessionKeysPerUser]bool
+}
+
+func NewKeyStore() *KeyStore {
+	return &KeyStore{}
+}
+
+// Load replaces the stored keys with set, used as user (1-based). Keys
+// recorded in ledger, which may be nil, are treated as consumed. The
+// previous key set is wiped.
+func (s *KeyStore) Load(set *KeySet, user int, ledger *Ledger) error {
+	if user < 1 || user > set.Users {
+		return fmt.Errorf("%w: user %d, key set has %d users", ErrBadUserCount, user, set.Users)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set != set {
+		s.wipe()
+	}
+	s.set = set
+	s.user = user
+	s.ledger = ledger
+	if ledger != nil {
+		for i := range s.taken {
+			s.taken[i] = ledger.Used(user-1, i)
+		}
+	}
+	return nil
+}
+
+// Loaded reports whether a key set is loaded.
+func (s *KeyStore) Loaded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set != nil
+}
+
+// User returns the own user number, or 0 when no keys are loaded.
+func (s *KeyStore) User() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+// Users returns the number of users in the loaded key set.
+func (s *KeyStore) Users() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return 0
+	}
+	return s.set.Users
+}
+
+// KeyLen returns the key length of the loaded key set.
+func (s *KeyStore) KeyLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return 0
+	}
+	return s.set.KeyLen
+}
+
+func (s *KeyStore) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return ErrKeysNotLoaded.Error()
+	}
+	return fmt.Sprintf("User %d of %s", s.user, s.set)
+}
+
+// ImitKey returns the key that authenticates files of this key set.
+func (s *KeyStore) ImitKey() (cipher.Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return nil, ErrKeysNotLoaded
+	}
+	return NewCipher(s.set.kikey, BLOCKLEN)
+}
+
+// CircleKey returns circle key n.
+func (s *KeyStore) CircleKey(n int) (cipher.Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return nil, ErrKeysNotLoaded
+	}
+	if n < 0 || n >= CircleKeyCount {
+		return nil, fmt.Errorf("circle key %d out of range", n)
+	}
+	return NewCipher(s.set.Circle[n], BLOCKLEN)
+}
+
+// SessionKey returns session key idx of user (1-based) for decryption,
+// whether or not it has been consumed.
+func (s *KeyStore) SessionKey(user, idx int) (cipher.Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return nil, ErrKeysNotLoaded
+	}
+	if user < 1 || user > s.set.Users {
+		return nil, fmt.Errorf("%w: user %d, key set has %d users", ErrBadUserCount, user, s.set.Users)
+	}
+	if idx < 0 || idx >= SessionKeysPerUser {
+		return nil, fmt.Errorf("session key %d out of range", idx)
+	}
+	return NewCipher(s.set.Session[user-1][idx], BLOCKLEN)
+}
+
+// FileKey returns the key a file with header h was encrypted with.
+func (s *KeyStore) FileKey(h *FileHeader) (cipher.Block, error) {
+	switch h.KeyType {
+	case KeyTypeCircle:
+		return s.CircleKey(h.CircleKey)
+	case KeyTypeSession:
+		return s.SessionKey(h.Sender, h.SessionKey)
+	}
+	return nil, fmt.Errorf("%w 0x%02X", ErrUnknownKeyType, h.KeyType)
+}
+
+// NewFileHeader picks a key of keyType, KeyTypeCircle or KeyTypeSession,
+// at random and returns it with a CTR header for a file from the own user
+// to recipient. A session key is taken as by TakeSessionKey.
+func (s *KeyStore) NewFileHeader(keyType byte, recipient int) (*FileHeader, cipher.Block, error) {
+	h := &FileHeader{
+		Mode:      ModeCTR,
+		KeyLen:    s.KeyLen(),
+		KeyType:   keyType,
+		Sender:    s.User(),
+		Recipient: recipient,
+	}
+	var fileKey cipher.Block
+	var err error
+	switch keyType {
+	case KeyTypeCircle:
+		if h.CircleKey, err = randIndex(CircleKeyCount); err == nil {
+			fileKey, err = s.CircleKey(h.CircleKey)
+		}
+	case KeyTypeSession:
+		var start int
+		if start, err = randIndex(SessionKeysPerUser); err == nil {
+			fileKey, h.SessionKey, err = s.TakeSessionKey(start)
+		}
+	default:
+		err = fmt.Errorf("%w 0x%02X", ErrUnknownKeyType, keyType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, fileKey, nil
+}
+
+// randIndex returns a uniform random number in [0, n) from crypto/rand.
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("pick a key: %w", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// TakeSessionKey consumes the first unused session key of the own user at
+// or after start, wrapping around, and returns it with its index. Call
+// CommitSessionKey once the key has protected data that was written out.
+func (s *KeyStore) TakeSessionKey(start int) (cipher.Block, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return nil, -1, ErrKeysNotLoaded
+	}
+	if start < 0 || start >= SessionKeysPerUser {
+		return nil, -1, fmt.Errorf("session key %d out of range", start)
+	}
+	for i := 0; i < SessionKeysPerUser; i++ {
+		idx := (start + i) % SessionKeysPerUser
+		if s.taken[idx] {
+			continue
+		}
+		b, err := NewCipher(s.set.Session[s.user-1][idx], BLOCKLEN)
+		if err != nil {
+			return nil, -1, err
+		}
+		s.taken[idx] = true
+		return b, idx, nil
+	}
+	return nil, -1, ErrKeyExhausted
+}
+
+// ReleaseSessionKey returns session key idx of the own user to the unused
+// keys after TakeSessionKey, when nothing it protected was written out. A
+// key already recorded in the ledger stays consumed.
+func (s *KeyStore) ReleaseSessionKey(idx int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil || idx < 0 || idx >= SessionKeysPerUser {
+		return
+	}
+	if s.ledger != nil && s.ledger.Used(s.user-1, idx) {
+		return
+	}
+	s.taken[idx] = false
+}
+
+// CommitSessionKey records session key idx of the own user in the ledger.
+func (s *KeyStore) CommitSessionKey(idx int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return ErrKeysNotLoaded
+	}
+	if s.ledger == nil {
+		return nil
+	}
+	return s.ledger.MarkUsed(s.user-1, idx)
+}
+
+// Remaining returns how many session keys of the own user are unused.
+func (s *KeyStore) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.set == nil {
+		return 0
+	}
+	n := 0
+	for _, t := range s.taken {
+		if !t {
+			n++
+		}
+	}
+	return n
+}
+
+// Wipe zeroes the loaded key material and unloads it.
+func (s *KeyStore) Wipe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wipe()
+}
+
+func (s *KeyStore) wipe() {
+	if s.set != nil {
+		s.set.Wipe()
+	}
+	s.set = nil
+	s.user = 0
+	s.ledger = nil
+	s.taken = [SessionKeysPerUser]bool{}
+}
@@ -0,0 +1,223 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestKeyStoreTakeAndCommit(t *testing.T) {
+	data := writeKeySet(t, cheapHeader(t, 32), "secret", 2)
+	ks := loadKeySet(t, data)
+	path := LedgerPath(filepath.Join(t.TempDir(), "keys.bin"))
+	ledger, err := CreateLedger(path, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewKeyStore()
+	if _, _, err := s.TakeSessionKey(0); !errors.Is(err, ErrKeysNotLoaded) {
+		t.Fatalf("empty store: got %v, want ErrKeysNotLoaded", err)
+	}
+	if err := s.Load(ks, 3, ledger); !errors.Is(err, ErrBadUserCount) {
+		t.Fatalf("user 3 of 2: got %v, want ErrBadUserCount", err)
+	}
+	if err := s.Load(ks, 2, ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	b, idx, err := s.TakeSessionKey(99)
+	if err != nil || idx != 99 {
+		t.Fatalf("TakeSessionKey(99) = %d, %v", idx, err)
+	}
+	if err := s.CommitSessionKey(idx); err != nil {
+		t.Fatal(err)
+	}
+	if _, idx, _ = s.TakeSessionKey(99); idx != 0 {
+		t.Fatalf("TakeSessionKey(99) after use = %d, want 0", idx)
+	}
+	if s.Remaining() != SessionKeysPerUser-2 {
+		t.Fatalf("Remaining = %d", s.Remaining())
+	}
+	s.ReleaseSessionKey(0)
+	s.ReleaseSessionKey(99)
+	if s.Remaining() != SessionKeysPerUser-1 {
+		t.Fatalf("Remaining after release = %d, want the committed key to stay used", s.Remaining())
+	}
+	if _, idx, _ = s.TakeSessionKey(0); idx != 0 {
+		t.Fatalf("TakeSessionKey(0) after release = %d, want 0", idx)
+	}
+
+	dec, err := s.SessionKey(2, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := katPlain(BLOCKLEN)
+	c1, c2 := make([]byte, BLOCKLEN), make([]byte, BLOCKLEN)
+	b.Encrypt(c1, in)
+	dec.Encrypt(c2, in)
+	if !bytes.Equal(c1, c2) {
+		t.Fatal("SessionKey differs from the consumed key")
+	}
+
+	// Only committed keys survive a reload.
+	ks = loadKeySet(t, data)
+	ledger, err = OpenLedger(path, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(ks, 2, ledger); err != nil {
+		t.Fatal(err)
+	}
+	if s.Remaining() != SessionKeysPerUser-1 {
+		t.Fatalf("Remaining after reload = %d", s.Remaining())
+	}
+}
+
+func TestKeyStoreExhaustedAndWipe(t *testing.T) {
+	ks := loadKeySet(t, writeKeySet(t, cheapHeader(t, 48), "secret", 1))
+	s := NewKeyStore()
+	if err := s.Load(ks, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	seen := make(chan int, SessionKeysPerUser)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, idx, err := s.TakeSessionKey(0)
+				if errors.Is(err, ErrKeyExhausted) {
+					return
+				}
+				seen <- idx
+			}
+		}()
+	}
+	wg.Wait()
+	close(seen)
+	got := map[int]bool{}
+	for idx := range seen {
+		if got[idx] {
+			t.Fatalf("session key %d handed out twice", idx)
+		}
+		got[idx] = true
+	}
+	if len(got) != SessionKeysPerUser {
+		t.Fatalf("handed out %d keys", len(got))
+	}
+
+	if _, err := s.FileKey(&FileHeader{KeyType: 0x7F}); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("FileKey with key type 0x7F: err = %v, want ErrUnknownKeyType", err)
+	}
+
+	circle := ks.Circle[3]
+	s.Wipe()
+	if s.Loaded() || !bytes.Equal(circle, make([]byte, 48)) {
+		t.Fatal("Wipe left key material behind")
+	}
+	if _, err := s.CircleKey(3); !errors.Is(err, ErrKeysNotLoaded) {
+		t.Fatalf("CircleKey after Wipe: got %v", err)
+	}
+}
+
+// TestKeyStoreWipeWhileInUse wipes the store while keys it handed out are
+// still encrypting; run it with -race.
+func TestKeyStoreWipeWhileInUse(t *testing.T) {
+	ks := loadKeySet(t, writeKeySet(t, cheapHeader(t, 32), "secret", 1))
+	s := NewKeyStore()
+	if err := s.Load(ks, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	var keys []cipher.Block
+	for _, get := range []func() (cipher.Block, error){
+		s.ImitKey,
+		func() (cipher.Block, error) { return s.CircleKey(0) },
+		func() (cipher.Block, error) { return s.SessionKey(1, 0) },
+	} {
+		b, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, b)
+	}
+	in := katPlain(BLOCKLEN)
+	want := make([][]byte, len(keys))
+	for i, b := range keys {
+		want[i] = make([]byte, BLOCKLEN)
+		b.Encrypt(want[i], in)
+	}
+
+	var wg sync.WaitGroup
+	for i, b := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := make([]byte, BLOCKLEN)
+			for j := 0; j < 2000; j++ {
+				b.Encrypt(out, in)
+				if !bytes.Equal(out, want[i]) {
+					t.Errorf("key %d changed while the store was wiped", i)
+					return
+				}
+			}
+		}()
+	}
+	s.Wipe()
+	wg.Wait()
+}
+
+func TestKeyStoreNewFileHeader(t *testing.T) {
+	ks := loadKeySet(t, writeKeySet(t, cheapHeader(t, 32), "secret", 2))
+	s := NewKeyStore()
+	if _, _, err := s.NewFileHeader(KeyTypeCircle, 0); !errors.Is(err, ErrKeysNotLoaded) {
+		t.Fatalf("empty store: got %v, want ErrKeysNotLoaded", err)
+	}
+	if err := s.Load(ks, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h, b, err := s.NewFileHeader(KeyTypeSession, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.KeyType != KeyTypeSession || h.Mode != ModeCTR || h.KeyLen != 32 || h.Sender != 2 || h.Recipient != 1 {
+		t.Fatalf("session header %+v", h)
+	}
+	if s.Remaining() != SessionKeysPerUser-1 {
+		t.Fatalf("Remaining = %d, want the session key taken", s.Remaining())
+	}
+	want, err := s.SessionKey(2, h.SessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := katPlain(BLOCKLEN)
+	c1, c2 := make([]byte, BLOCKLEN), make([]byte, BLOCKLEN)
+	b.Encrypt(c1, in)
+	want.Encrypt(c2, in)
+	if !bytes.Equal(c1, c2) {
+		t.Fatal("session key does not match its header")
+	}
+
+	h, b, err = s.NewFileHeader(KeyTypeCircle, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, err = s.CircleKey(h.CircleKey); err != nil {
+		t.Fatal(err)
+	}
+	b.Encrypt(c1, in)
+	want.Encrypt(c2, in)
+	if h.KeyType != KeyTypeCircle || !bytes.Equal(c1, c2) {
+		t.Fatalf("circle key does not match its header %+v", h)
+	}
+
+	if _, _, err := s.NewFileHeader(0x7F, 0); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("key type 0x7F: err = %v, want ErrUnknownKeyType", err)
+	}
+}
@@ -0,0 +1,186 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+The ledger records which session keys of a key set have been used, so that
+reloading the key file does not bring them back. It is stored next to the key
+file as:
+
+* 0 - 3   - magic "QLQU";
+* 4       - version;
+* 5 - 20  - nonce;
+* 21 -    - AEAD-sealed bitmap, one bit per (user, index), user-major.
+
+The AEAD key is the kikey of the key set and the additional data is the
+magic, the version and the key file imit, so a ledger only opens with the key
+set it belongs to.
+*/
+
+const ledgerVersion = 1
+
+var ledgerMagic = []byte("QLQU")
+
+// Ledger is the persistent record of consumed session keys of one key set.
+type Ledger struct {
+	mu    sync.Mutex
+	path  string
+	aead  cipher.AEAD
+	ad    []byte
+	users int
+	used  []byte
+}
+
+// LedgerPath returns where the ledger of keyFile is stored.
+func LedgerPath(keyFile string) string {
+	return keyFile + ".used"
+}
+
+// OpenLedger loads the ledger at path for ks. A missing file returns
+// ErrLedgerMissing rather than an empty ledger, since losing the file would
+// otherwise bring every consumed key back; a ledger that fails
+// authentication returns ErrMACMismatch.
+func OpenLedger(path string, ks *KeySet) (*Ledger, error) {
+	l, err := newLedger(path, ks)
+	if err != nil {
+		return nil, err
+	}
+	aead := l.aead
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrLedgerMissing, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ledger: %w", err)
+	}
+
+	hdrLen := len(ledgerMagic) + 1
+	if len(data) < hdrLen+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("ledger: %w", ErrTruncated)
+	}
+	if !bytes.Equal(data[:len(ledgerMagic)], ledgerMagic) {
+		return nil, errors.New("ledger: bad magic")
+	}
+	if data[len(ledgerMagic)] != ledgerVersion {
+		return nil, fmt.Errorf("ledger: %w: version %d", ErrUnsupportedVersion, data[len(ledgerMagic)])
+	}
+	nonce := data[hdrLen : hdrLen+aead.NonceSize()]
+	used, err := aead.Open(nil, nonce, data[hdrLen+aead.NonceSize():], l.ad)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: %w", err)
+	}
+	if len(used) != len(l.used) {
+		return nil, fmt.Errorf("ledger: %w: covers %d bytes, key set needs %d", ErrBadUserCount, len(used), len(l.used))
+	}
+	l.used = used
+	return l, nil
+}
+
+// CreateLedger writes an empty ledger for ks at path, replacing any file
+// there. It is meant for freshly generated key sets and for an explicit
+// reset after the user confirms that a missing ledger may be started anew.
+func CreateLedger(path string, ks *KeySet) (*Ledger, error) {
+	l, err := newLedger(path, ks)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.save(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func newLedger(path string, ks *KeySet) (*Ledger, error) {
+	aead, err := NewAEAD(ks.kikey)
+	if err != nil {
+		return nil, err
+	}
+	return &Ledger{
+		path:  path,
+		aead:  aead,
+		ad:    append(append(append([]byte(nil), ledgerMagic...), ledgerVersion), ks.imit[:]...),
+		users: ks.Users,
+		used:  make([]byte, (ks.Users*SessionKeysPerUser+7)/8),
+	}, nil
+}
+
+// Used reports whether session key index of user has been consumed.
+func (l *Ledger) Used(user, index int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bit, ok := l.bit(user, index)
+	return ok && l.used[bit/8]&(1<<(bit%8)) != 0
+}
+
+// Apply zeroes every consumed key in session.
+func (l *Ledger) Apply(session [][SessionKeysPerUser][]byte) {
+	for u := range session {
+		for i := range session[u] {
+			if l.Used(u, i) {
+				clear(session[u][i])
+			}
+		}
+	}
+}
+
+// MarkUsed records session key index of user as consumed and writes the
+// ledger to disk, replacing the previous file atomically.
+func (l *Ledger) MarkUsed(user, index int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bit, ok := l.bit(user, index)
+	if !ok {
+		return fmt.Errorf("session key %d of user %d out of range", index, user)
+	}
+	l.used[bit/8] |= 1 << (bit % 8)
+	return l.save()
+}
+
+func (l *Ledger) bit(user, index int) (int, bool) {
+	if user < 0 || user >= l.users || index < 0 || index >= SessionKeysPerUser {
+		return 0, false
+	}
+	return user*SessionKeysPerUser + index, true
+}
+
+func (l *Ledger) save() error {
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	out := append(append([]byte(nil), ledgerMagic...), ledgerVersion)
+	out = append(out, nonce...)
+	out = l.aead.Seal(out, nonce, l.used, l.ad)
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package qalqan
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadKeySet(t *testing.T, data []byte) *KeySet {
+	t.Helper()
+	ks, err := LoadKeySet(bytes.NewReader(data), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestLedgerPersists(t *testing.T) {
+	data := writeKeySet(t, cheapHeader(t, 32), "secret", 2)
+	path := LedgerPath(filepath.Join(t.TempDir(), "keys.bin"))
+
+	if _, err := OpenLedger(path, loadKeySet(t, data)); !errors.Is(err, ErrLedgerMissing) {
+		t.Fatalf("no ledger file: got %v, want ErrLedgerMissing", err)
+	}
+	l, err := CreateLedger(path, loadKeySet(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Used(1, 7) {
+		t.Fatal("fresh ledger reports a used key")
+	}
+	for _, k := range [][2]int{{0, 0}, {1, 7}, {1, 99}} {
+		if err := l.MarkUsed(k[0], k[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.MarkUsed(2, 0); err == nil {
+		t.Fatal("out of range user accepted")
+	}
+
+	ks := loadKeySet(t, data)
+	l, err = OpenLedger(path, ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Apply(ks.Session)
+	for u := range ks.Session {
+		for i, key := range ks.Session[u] {
+			used := (u == 0 && i == 0) || (u == 1 && (i == 7 || i == 99))
+			if zero := bytes.Equal(key, make([]byte, len(key))); zero != used || l.Used(u, i) != used {
+				t.Fatalf("user %d key %d: zero=%v used=%v, want %v", u, i, zero, l.Used(u, i), used)
+			}
+		}
+	}
+
+	if _, err := CreateLedger(path, ks); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = OpenLedger(path, ks); err != nil || l.Used(1, 7) {
+		t.Fatalf("after CreateLedger: used=%v, err=%v", l != nil && l.Used(1, 7), err)
+	}
+
+	matches, _ := filepath.Glob(path + ".tmp*")
+	if len(matches) != 0 {
+		t.Fatalf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestLedgerRejectsTamperingAndOtherKeySets(t *testing.T) {
+	data := writeKeySet(t, cheapHeader(t, 32), "secret", 1)
+	path := LedgerPath(filepath.Join(t.TempDir(), "keys.bin"))
+	l, err := CreateLedger(path, loadKeySet(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.MarkUsed(0, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	other := writeKeySet(t, cheapHeader(t, 32), "secret", 1)
+	if _, err := OpenLedger(path, loadKeySet(t, other)); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("ledger of another key set: got %v, want ErrMACMismatch", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 1
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLedger(path, loadKeySet(t, data)); !errors.Is(err, ErrMACMismatch) {
+		t.Fatalf("tampered ledger: got %v, want ErrMACMismatch", err)
+	}
+}
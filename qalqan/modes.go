@@ -0,0 +1,136 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Mode is the encryption mode recorded in the file header.
+type Mode byte
+
+const (
+	ModeOFB Mode = 0x00
+	ModeECB Mode = 0x01
+	ModeCBC Mode = 0x02
+	ModeCTR Mode = 0x03
+)
+
+// String returns the mode name that ParseMode accepts.
+func (m Mode) String() string {
+	switch m {
+	case ModeOFB:
+		return "OFB"
+	case ModeECB:
+		return "ECB"
+	case ModeCBC:
+		return "CBC"
+	case ModeCTR:
+		return "CTR"
+	default:
+		return fmt.Sprintf("Mode(0x%02X)", byte(m))
+	}
+}
+
+// padsFull reports whether the mode ends block-aligned data with a whole
+// padding block. Writers, readers and the container all size by it.
+func (m Mode) padsFull() bool {
+	return m != ModeOFB
+}
+
+// ParseMode returns the mode named s: OFB, ECB, CBC or CTR.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{ModeOFB, ModeECB, ModeCBC, ModeCTR} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode %q", s)
+}
+
+// NewWriter returns a Writer that encrypts to w in the given mode. ECB
+// ignores iv.
+func NewWriter(w io.Writer, mode Mode, b cipher.Block, iv []byte) (*Writer, error) {
+	if err := checkModeParams(mode, b, iv); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case ModeOFB:
+		return newWriter(w, cipher.NewOFB(b, iv).XORKeyStream, mode.padsFull(), streamBufSize), nil
+	case ModeECB:
+		return newWriter(w, NewECBEncrypter(b).CryptBlocks, mode.padsFull(), streamBufSize), nil
+	case ModeCBC:
+		return newWriter(w, cipher.NewCBCEncrypter(b, iv).CryptBlocks, mode.padsFull(), streamBufSize), nil
+	case ModeCTR:
+		return NewCTRWriter(w, b, iv, runtime.GOMAXPROCS(0))
+	default:
+		return nil, fmt.Errorf("unsupported mode %v", mode)
+	}
+}
+
+// NewReader returns a Reader that decrypts r in the given mode.
+func NewReader(r io.Reader, mode Mode, b cipher.Block, iv []byte) (*Reader, error) {
+	if err := checkModeParams(mode, b, iv); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case ModeOFB:
+		return newReader(r, cipher.NewOFB(b, iv).XORKeyStream, mode.padsFull(), streamBufSize), nil
+	case ModeECB:
+		return newReader(r, NewECBDecrypter(b).CryptBlocks, mode.padsFull(), streamBufSize), nil
+	case ModeCBC:
+		return newReader(r, cipher.NewCBCDecrypter(b, iv).CryptBlocks, mode.padsFull(), streamBufSize), nil
+	case ModeCTR:
+		return NewCTRReader(r, b, iv, runtime.GOMAXPROCS(0))
+	default:
+		return nil, fmt.Errorf("unsupported mode %v", mode)
+	}
+}
+
+// checkModeParams validates b and iv for mode. The block modes pad with
+// myappend and so need BLOCKLEN blocks; ECB does not use iv.
+func checkModeParams(mode Mode, b cipher.Block, iv []byte) error {
+	if (mode == ModeECB || mode == ModeCBC) && b.BlockSize() != BLOCKLEN {
+		return BlockSizeError(b.BlockSize())
+	}
+	if mode != ModeECB && len(iv) != b.BlockSize() {
+		return fmt.Errorf("IV length must be %d bytes, got %d", b.BlockSize(), len(iv))
+	}
+	return nil
+}
+
+type ecb struct {
+	b       cipher.Block
+	encrypt bool
+}
+
+// NewECBEncrypter returns a cipher.BlockMode that encrypts each block
+// independently, for exchanging key blocks with legacy partners.
+func NewECBEncrypter(b cipher.Block) cipher.BlockMode {
+	return &ecb{b: b, encrypt: true}
+}
+
+// NewECBDecrypter returns the cipher.BlockMode that undoes NewECBEncrypter.
+func NewECBDecrypter(b cipher.Block) cipher.BlockMode {
+	return &ecb{b: b}
+}
+
+func (e *ecb) BlockSize() int { return e.b.BlockSize() }
+
+func (e *ecb) CryptBlocks(dst, src []byte) {
+	bs := e.b.BlockSize()
+	if len(src)%bs != 0 {
+		panic("qalqan: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("qalqan: output smaller than input")
+	}
+	for i := 0; i < len(src); i += bs {
+		if e.encrypt {
+			e.b.Encrypt(dst[i:i+bs], src[i:i+bs])
+		} else {
+			e.b.Decrypt(dst[i:i+bs], src[i:i+bs])
+		}
+	}
+}
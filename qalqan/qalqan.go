@@ -1,580 +1,551 @@
-package qalqan
-
-import (
-	"bufio"
-	"encoding/binary"
-	"errors"
-	"fmt"
-	"io"
-	"path/filepath"
-	"unsafe"
-)
-
-const (
-	KEXPSHIFT       = 17
-	RKEYLEN         = 16
-	BLOCKLEN        = 16
-	MAXBLOCKLEN     = 64
-	MINKEYLEN       = 32
-	MAXKEYLEN       = 128
-	KEYLENSTEP      = 16
-	MAXEXPKLEN      = 1024
-	DEFAULT_KEY_LEN = 32
-	EXPKLEN         = 272
-)
-
-/* Lin 32, Dif 4, PZh 7, deg 112, SAC 120 */
-var sb = [256]byte{
-	0xd1, 0xb5, 0xa6, 0x74, 0x2f, 0xb2, 0x03, 0x77, 0xae, 0xb3, 0x60, 0x95, 0xfd, 0xf8, 0xc7, 0xf0,
-	0x2b, 0xce, 0xa5, 0x91, 0x4c, 0x6f, 0xf3, 0x4f, 0x82, 0x01, 0x45, 0x76, 0x9f, 0xed, 0x41, 0xfb,
-	0xac, 0x4e, 0x5e, 0x04, 0xeb, 0xf9, 0xf1, 0x3a, 0x1f, 0xe2, 0x8e, 0xe7, 0x85, 0x35, 0xdb, 0x52,
-	0x78, 0xa1, 0xfc, 0xa2, 0xde, 0x68, 0x02, 0x4d, 0xf6, 0xdd, 0xcf, 0xa3, 0xdc, 0x6b, 0x81, 0x44,
-	0x2a, 0x5d, 0x1e, 0xe0, 0x53, 0x71, 0x3b, 0xc1, 0xcc, 0x9d, 0x80, 0xd5, 0x84, 0x00, 0x24, 0x4b,
-	0xb6, 0x83, 0x0d, 0x87, 0x7e, 0x86, 0xca, 0x96, 0xbe, 0x5a, 0xe6, 0xd0, 0xd4, 0xd8, 0x55, 0xc0,
-	0x05, 0xe5, 0xe9, 0x5b, 0x47, 0xe4, 0x2d, 0x34, 0x13, 0x88, 0x48, 0x32, 0x38, 0xb9, 0xda, 0xc9,
-	0x42, 0x29, 0xd7, 0xf2, 0x9b, 0x6d, 0xe8, 0x8d, 0x12, 0x7c, 0x8c, 0x3f, 0xbc, 0x3c, 0x1b, 0xc5,
-	0x69, 0x22, 0x97, 0xaa, 0x73, 0x0a, 0x0c, 0x8a, 0x90, 0x31, 0xc4, 0x33, 0xe1, 0x8b, 0x9c, 0x63,
-	0x5f, 0xf5, 0xf7, 0xff, 0x79, 0x49, 0xd3, 0xc6, 0x7b, 0x1a, 0x39, 0xc8, 0x6e, 0x72, 0xd9, 0xc3,
-	0x62, 0x28, 0xbd, 0xbb, 0xfa, 0x2e, 0xbf, 0x43, 0x06, 0x0b, 0x7a, 0x64, 0x5c, 0x92, 0x37, 0x3d,
-	0x66, 0x26, 0x51, 0xef, 0x0f, 0xa9, 0x14, 0x70, 0x16, 0x17, 0x10, 0x19, 0x93, 0x09, 0x59, 0x15,
-	0xfe, 0x4a, 0xcb, 0x2c, 0xcd, 0xb8, 0x94, 0xab, 0xdf, 0xa7, 0x0e, 0x30, 0xaf, 0x56, 0x23, 0xb1,
-	0xb0, 0x58, 0x7d, 0xc2, 0x1d, 0x50, 0x20, 0x61, 0x25, 0x89, 0xa0, 0x6c, 0x11, 0x54, 0x98, 0xb7,
-	0x18, 0x21, 0xad, 0x3e, 0xd2, 0xea, 0x40, 0xd6, 0xf4, 0xa4, 0x8f, 0xa8, 0x08, 0x57, 0xba, 0xee,
-	0x75, 0x6a, 0x07, 0x99, 0x7f, 0x1c, 0xe3, 0x46, 0x67, 0xec, 0x27, 0x36, 0xb4, 0x65, 0x9e, 0x9a,
-}
-
-var isb = [256]byte{
-	0x4d, 0x19, 0x36, 0x06, 0x23, 0x60, 0xa8, 0xf2, 0xec, 0xbd, 0x85, 0xa9, 0x86, 0x52, 0xca, 0xb4,
-	0xba, 0xdc, 0x78, 0x68, 0xb6, 0xbf, 0xb8, 0xb9, 0xe0, 0xbb, 0x99, 0x7e, 0xf5, 0xd4, 0x42, 0x28,
-	0xd6, 0xe1, 0x81, 0xce, 0x4e, 0xd8, 0xb1, 0xfa, 0xa1, 0x71, 0x40, 0x10, 0xc3, 0x66, 0xa5, 0x04,
-	0xcb, 0x89, 0x6b, 0x8b, 0x67, 0x2d, 0xfb, 0xae, 0x6c, 0x9a, 0x27, 0x46, 0x7d, 0xaf, 0xe3, 0x7b,
-	0xe6, 0x1e, 0x70, 0xa7, 0x3f, 0x1a, 0xf7, 0x64, 0x6a, 0x95, 0xc1, 0x4f, 0x14, 0x37, 0x21, 0x17,
-	0xd5, 0xb2, 0x2f, 0x44, 0xdd, 0x5e, 0xcd, 0xed, 0xd1, 0xbe, 0x59, 0x63, 0xac, 0x41, 0x22, 0x90,
-	0x0a, 0xd7, 0xa0, 0x8f, 0xab, 0xfd, 0xb0, 0xf8, 0x35, 0x80, 0xf1, 0x3d, 0xdb, 0x75, 0x9c, 0x15,
-	0xb7, 0x45, 0x9d, 0x84, 0x03, 0xf0, 0x1b, 0x07, 0x30, 0x94, 0xaa, 0x98, 0x79, 0xd2, 0x54, 0xf4,
-	0x4a, 0x3e, 0x18, 0x51, 0x4c, 0x2c, 0x55, 0x53, 0x69, 0xd9, 0x87, 0x8d, 0x7a, 0x77, 0x2a, 0xea,
-	0x88, 0x13, 0xad, 0xbc, 0xc6, 0x0b, 0x57, 0x82, 0xde, 0xf3, 0xff, 0x74, 0x8e, 0x49, 0xfe, 0x1c,
-	0xda, 0x31, 0x33, 0x3b, 0xe9, 0x12, 0x02, 0xc9, 0xeb, 0xb5, 0x83, 0xc7, 0x20, 0xe2, 0x08, 0xcc,
-	0xd0, 0xcf, 0x05, 0x09, 0xfc, 0x01, 0x50, 0xdf, 0xc5, 0x6d, 0xee, 0xa3, 0x7c, 0xa2, 0x58, 0xa6,
-	0x5f, 0x47, 0xd3, 0x9f, 0x8a, 0x7f, 0x97, 0x0e, 0x9b, 0x6f, 0x56, 0xc2, 0x48, 0xc4, 0x11, 0x3a,
-	0x5b, 0x00, 0xe4, 0x96, 0x5c, 0x4b, 0xe7, 0x72, 0x5d, 0x9e, 0x6e, 0x2e, 0x3c, 0x39, 0x34, 0xc8,
-	0x43, 0x8c, 0x29, 0xf6, 0x65, 0x61, 0x5a, 0x2b, 0x76, 0x62, 0xe5, 0x24, 0xf9, 0x1d, 0xef, 0xb3,
-	0x0f, 0x26, 0x73, 0x16, 0xe8, 0x91, 0x38, 0x92, 0x0d, 0x25, 0xa4, 0x1f, 0x32, 0x0c, 0xc0, 0x93,
-}
-
-func RNDS(x uint32) uint32 {
-	return 16 + (x-32)/16
-}
-
-func Kexp(key []byte, klen int, blen int, rkey []byte) {
-	var r0 [17]byte
-	var r1 [15]byte
-	addk := klen - 32
-	step := 0
-	s := KEXPSHIFT
-
-	for i := 0; i < 15; i++ {
-		r0[i] = key[2*i]
-		r1[i] = key[2*i+1]
-	}
-	r0[15] = key[30]
-	r0[16] = key[31]
-
-	nr := int(RNDS(uint32(klen)))
-	for r := 0; r < nr; r++ {
-		for k := 0; k < blen+s; k++ {
-			t0 := sb[r0[0]] + r0[1] + sb[r0[3]] + r0[7] + sb[r0[12]] + r0[16]
-			t1 := sb[r1[0]] + r1[3] + sb[r1[9]] + r1[12] + sb[r1[14]]
-
-			for i := 0; i < 14; i++ {
-				r0[i] = r0[i+1]
-				r1[i] = r1[i+1]
-			}
-			r0[14] = r0[15]
-			r0[15] = r0[16]
-
-			if k >= s {
-				rkey[r*blen+k-s] = t0 + r1[4]
-				if step < addk {
-					if (step & 1) == 1 {
-						t0 += key[32+step]
-					} else {
-						t1 += key[32+step]
-					}
-					step++
-				}
-			}
-
-			r0[16] = t0
-			r1[14] = t1
-		}
-		s = 0
-	}
-}
-
-func ROTL(x uint32, s uint32) uint32 {
-	s &= 31
-	return (x << s) | (x >> (32 - s))
-}
-func ROTL64(x uint64, s uint64) uint64 {
-	s &= 63
-	return (x << s) | (x >> (64 - s))
-}
-
-func Lin344(din, dout []uint32, c0 []uint32) {
-	if len(din) < 4 || len(dout) < 4 || len(c0) < 3 {
-		panic("Lin344: bad input lengths")
-	}
-	dout[0] = din[0] ^ ROTL(din[1], c0[0]) ^ ROTL(din[2], c0[1]) ^ ROTL(din[3], c0[2])
-	dout[1] = din[1] ^ ROTL(din[2], c0[0]) ^ ROTL(din[3], c0[1]) ^ ROTL(dout[0], c0[2])
-	dout[2] = din[2] ^ ROTL(din[3], c0[0]) ^ ROTL(dout[0], c0[1]) ^ ROTL(dout[1], c0[2])
-	dout[3] = din[3] ^ ROTL(dout[0], c0[0]) ^ ROTL(dout[1], c0[1]) ^ ROTL(dout[2], c0[2])
-}
-func Lin384(din, dout []uint32, c1 []uint32) {
-	dout[0] = din[0] ^ ROTL(din[1], c1[0]) ^ ROTL(din[2], c1[1]) ^ ROTL(din[3], c1[2]) ^ ROTL(din[4], c1[3]) ^ ROTL(din[5], c1[4]) ^ ROTL(din[6], c1[5]) ^ ROTL(din[7], c1[6])
-	dout[1] = din[1] ^ ROTL(din[2], c1[0]) ^ ROTL(din[3], c1[1]) ^ ROTL(din[4], c1[2]) ^ ROTL(din[5], c1[3]) ^ ROTL(din[6], c1[4]) ^ ROTL(din[7], c1[5]) ^ ROTL(dout[0], c1[6])
-	dout[2] = din[2] ^ ROTL(din[3], c1[0]) ^ ROTL(din[4], c1[1]) ^ ROTL(din[5], c1[2]) ^ ROTL(din[6], c1[3]) ^ ROTL(din[7], c1[4]) ^ ROTL(dout[0], c1[5]) ^ ROTL(dout[1], c1[6])
-	dout[3] = din[3] ^ ROTL(din[4], c1[0]) ^ ROTL(din[5], c1[1]) ^ ROTL(din[6], c1[2]) ^ ROTL(din[7], c1[3]) ^ ROTL(dout[0], c1[4]) ^ ROTL(dout[1], c1[5]) ^ ROTL(dout[2], c1[6])
-	dout[4] = din[4] ^ ROTL(din[5], c1[0]) ^ ROTL(din[6], c1[1]) ^ ROTL(din[7], c1[2]) ^ ROTL(dout[0], c1[3]) ^ ROTL(dout[1], c1[4]) ^ ROTL(dout[2], c1[5]) ^ ROTL(dout[3], c1[6])
-	dout[5] = din[5] ^ ROTL(din[6], c1[0]) ^ ROTL(din[7], c1[1]) ^ ROTL(dout[0], c1[2]) ^ ROTL(dout[1], c1[3]) ^ ROTL(dout[2], c1[4]) ^ ROTL(dout[3], c1[5]) ^ ROTL(dout[4], c1[6])
-	dout[6] = din[6] ^ ROTL(din[7], c1[0]) ^ ROTL(dout[0], c1[1]) ^ ROTL(dout[1], c1[2]) ^ ROTL(dout[2], c1[3]) ^ ROTL(dout[3], c1[4]) ^ ROTL(dout[4], c1[5]) ^ ROTL(dout[5], c1[6])
-	dout[7] = din[7] ^ ROTL(dout[0], c1[0]) ^ ROTL(dout[1], c1[1]) ^ ROTL(dout[2], c1[2]) ^ ROTL(dout[3], c1[3]) ^ ROTL(dout[4], c1[4]) ^ ROTL(dout[5], c1[5]) ^ ROTL(dout[6], c1[6])
-}
-func Lin388(din, dout []uint64, c2 []uint64) {
-	dout[0] = din[0] ^ ROTL64(din[1], c2[0]) ^ ROTL64(din[2], c2[1]) ^ ROTL64(din[3], c2[2]) ^ ROTL64(din[4], c2[3]) ^ ROTL64(din[5], c2[4]) ^ ROTL64(din[6], c2[5]) ^ ROTL64(din[7], c2[6])
-	dout[1] = din[1] ^ ROTL64(din[2], c2[0]) ^ ROTL64(din[3], c2[1]) ^ ROTL64(din[4], c2[2]) ^ ROTL64(din[5], c2[3]) ^ ROTL64(din[6], c2[4]) ^ ROTL64(din[7], c2[5]) ^ ROTL64(dout[0], c2[6])
-	dout[2] = din[2] ^ ROTL64(din[3], c2[0]) ^ ROTL64(din[4], c2[1]) ^ ROTL64(din[5], c2[2]) ^ ROTL64(din[6], c2[3]) ^ ROTL64(din[7], c2[4]) ^ ROTL64(dout[0], c2[5]) ^ ROTL64(dout[1], c2[6])
-	dout[3] = din[3] ^ ROTL64(din[4], c2[0]) ^ ROTL64(din[5], c2[1]) ^ ROTL64(din[6], c2[2]) ^ ROTL64(din[7], c2[3]) ^ ROTL64(dout[0], c2[4]) ^ ROTL64(dout[1], c2[5]) ^ ROTL64(dout[2], c2[6])
-	dout[4] = din[4] ^ ROTL64(din[5], c2[0]) ^ ROTL64(din[6], c2[1]) ^ ROTL64(din[7], c2[2]) ^ ROTL64(dout[0], c2[3]) ^ ROTL64(dout[1], c2[4]) ^ ROTL64(dout[2], c2[5]) ^ ROTL64(dout[3], c2[6])
-	dout[5] = din[5] ^ ROTL64(din[6], c2[0]) ^ ROTL64(din[7], c2[1]) ^ ROTL64(dout[0], c2[2]) ^ ROTL64(dout[1], c2[3]) ^ ROTL64(dout[2], c2[4]) ^ ROTL64(dout[3], c2[5]) ^ ROTL64(dout[4], c2[6])
-	dout[6] = din[6] ^ ROTL64(din[7], c2[0]) ^ ROTL64(dout[0], c2[1]) ^ ROTL64(dout[1], c2[2]) ^ ROTL64(dout[2], c2[3]) ^ ROTL64(dout[3], c2[4]) ^ ROTL64(dout[4], c2[5]) ^ ROTL64(dout[5], c2[6])
-	dout[7] = din[7] ^ ROTL64(dout[0], c2[0]) ^ ROTL64(dout[1], c2[1]) ^ ROTL64(dout[2], c2[2]) ^ ROTL64(dout[3], c2[3]) ^ ROTL64(dout[4], c2[4]) ^ ROTL64(dout[5], c2[5]) ^ ROTL64(dout[6], c2[6])
-}
-
-func LinOp(d, r unsafe.Pointer, blocklen int) {
-	switch blocklen {
-	case 16:
-		Lin344((*[4]uint32)(d)[:], (*[4]uint32)(r)[:], []uint32{1, 17, 14})
-	case 32:
-		Lin384((*[8]uint32)(d)[:], (*[8]uint32)(r)[:], []uint32{3, 5, 11, 21, 16, 30, 19})
-	case 64:
-		Lin388((*[8]uint64)(d)[:], (*[8]uint64)(r)[:], []uint64{4, 0, 22, 27, 47, 4, 61})
-	default:
-		panic("LinOp: unexpected block length")
-	}
-}
-func InvlinOp(d, r unsafe.Pointer, blocklen int) {
-	switch blocklen {
-	case 16:
-		Ilin344((*[4]uint32)(d)[:], (*[4]uint32)(r)[:], []uint32{1, 17, 14})
-	case 32:
-		Ilin384((*[8]uint32)(d)[:], (*[8]uint32)(r)[:], []uint32{3, 5, 11, 21, 16, 30, 19})
-	case 64:
-		Ilin388((*[8]uint64)(d)[:], (*[8]uint64)(r)[:], []uint64{4, 0, 22, 27, 47, 4, 61})
-	default:
-		panic("InvlinOp: unexpected block length")
-	}
-}
-
-func sBox(data, res []uint8, blen int, sb []byte) {
-	for i := 0; i < blen; i++ {
-		res[i] = sb[data[i]]
-	}
-}
-func InvsBox(data, res []uint8, blen int) {
-	for i := 0; i < blen; i++ {
-		res[i] = isb[data[i]]
-	}
-}
-func AddRkX(block, rkey []uint8, nr, blen int, res []uint8) {
-	for i := 0; i < blen; i++ {
-		res[i] = block[i] ^ rkey[nr*blen+i]
-	}
-}
-func AddRk(block, rkey []uint8, nr, blen int, res []uint8) {
-	tmp := uint16(block[0]) + uint16(rkey[blen*nr])
-	res[0] = uint8(tmp)
-	tmp >>= 8
-	for i := 1; i < blen; i++ {
-		tmp += uint16(block[i]) + uint16(rkey[blen*nr+i])
-		res[i] = uint8(tmp)
-		tmp >>= 8
-	}
-}
-
-func Encrypt(data, rkey []uint8, klen int, blen int, res []uint8) {
-	var block [MAXBLOCKLEN]uint8
-	var block2 [MAXBLOCKLEN]uint8
-
-	AddRk(data, rkey, 0, blen, block[:])
-	sBox(block[:], block2[:], blen, sb[:])
-	LinOp(unsafe.Pointer(&block2[0]), unsafe.Pointer(&block[0]), blen)
-
-	nr := int(RNDS(uint32(klen)))
-	for i := 1; i < nr-1; i++ {
-		AddRkX(block[:], rkey, i, blen, block2[:])
-		sBox(block2[:], block2[:], blen, sb[:])
-		LinOp(unsafe.Pointer(&block2[0]), unsafe.Pointer(&block[0]), blen)
-	}
-	AddRk(block[:], rkey, nr-1, blen, res)
-}
-
-func InvAddRk(block, rkey []uint8, nr int, blen int) []uint8 {
-	res := make([]byte, blen)
-	tmp := int(block[0]) - int(rkey[blen*nr])
-	res[0] = uint8(tmp)
-	tmp >>= 8
-	for i := 1; i < blen; i++ {
-		tmp += int(block[i]) - int(rkey[blen*nr+i])
-		res[i] = uint8(tmp)
-		tmp >>= 8
-	}
-	return res
-}
-
-func Ilin344(din, dout []uint32, c0 []uint32) {
-	dout[3] = din[3] ^ ROTL(din[0], c0[0]) ^ ROTL(din[1], c0[1]) ^ ROTL(din[2], c0[2])
-	dout[2] = din[2] ^ ROTL(dout[3], c0[0]) ^ ROTL(din[0], c0[1]) ^ ROTL(din[1], c0[2])
-	dout[1] = din[1] ^ ROTL(dout[2], c0[0]) ^ ROTL(dout[3], c0[1]) ^ ROTL(din[0], c0[2])
-	dout[0] = din[0] ^ ROTL(dout[1], c0[0]) ^ ROTL(dout[2], c0[1]) ^ ROTL(dout[3], c0[2])
-}
-func Ilin384(din, dout []uint32, c1 []uint32) {
-	dout[7] = din[7] ^ ROTL(din[0], c1[0]) ^ ROTL(din[1], c1[1]) ^ ROTL(din[2], c1[2]) ^ ROTL(din[3], c1[3]) ^ ROTL(din[4], c1[4]) ^ ROTL(din[5], c1[5]) ^ ROTL(din[6], c1[6])
-	dout[6] = din[6] ^ ROTL(dout[7], c1[0]) ^ ROTL(din[0], c1[1]) ^ ROTL(din[1], c1[2]) ^ ROTL(din[2], c1[3]) ^ ROTL(din[3], c1[4]) ^ ROTL(din[4], c1[5]) ^ ROTL(din[5], c1[6])
-	dout[5] = din[5] ^ ROTL(dout[6], c1[0]) ^ ROTL(dout[7], c1[1]) ^ ROTL(din[0], c1[2]) ^ ROTL(din[1], c1[3]) ^ ROTL(din[2], c1[4]) ^ ROTL(din[3], c1[5]) ^ ROTL(din[4], c1[6])
-	dout[4] = din[4] ^ ROTL(dout[5], c1[0]) ^ ROTL(dout[6], c1[1]) ^ ROTL(dout[7], c1[2]) ^ ROTL(din[0], c1[3]) ^ ROTL(din[1], c1[4]) ^ ROTL(din[2], c1[5]) ^ ROTL(din[3], c1[6])
-	dout[3] = din[3] ^ ROTL(dout[4], c1[0]) ^ ROTL(dout[5], c1[1]) ^ ROTL(dout[6], c1[2]) ^ ROTL(dout[7], c1[3]) ^ ROTL(din[0], c1[4]) ^ ROTL(din[1], c1[5]) ^ ROTL(din[2], c1[6])
-	dout[2] = din[2] ^ ROTL(dout[3], c1[0]) ^ ROTL(dout[4], c1[1]) ^ ROTL(dout[5], c1[2]) ^ ROTL(dout[6], c1[3]) ^ ROTL(dout[7], c1[4]) ^ ROTL(din[0], c1[5]) ^ ROTL(din[1], c1[6])
-	dout[1] = din[1] ^ ROTL(dout[2], c1[0]) ^ ROTL(dout[3], c1[1]) ^ ROTL(dout[4], c1[2]) ^ ROTL(dout[5], c1[3]) ^ ROTL(dout[6], c1[4]) ^ ROTL(dout[7], c1[5]) ^ ROTL(din[0], c1[6])
-	dout[0] = din[0] ^ ROTL(dout[1], c1[0]) ^ ROTL(dout[2], c1[1]) ^ ROTL(dout[3], c1[2]) ^ ROTL(dout[4], c1[3]) ^ ROTL(dout[5], c1[4]) ^ ROTL(dout[6], c1[5]) ^ ROTL(dout[7], c1[6])
-}
-func Ilin388(din, dout []uint64, c2 []uint64) {
-	dout[7] = din[7] ^ ROTL64(din[0], c2[0]) ^ ROTL64(din[1], c2[1]) ^ ROTL64(din[2], c2[2]) ^ ROTL64(din[3], c2[3]) ^ ROTL64(din[4], c2[4]) ^ ROTL64(din[5], c2[5]) ^ ROTL64(din[6], c2[6])
-	dout[6] = din[6] ^ ROTL64(dout[7], c2[0]) ^ ROTL64(din[0], c2[1]) ^ ROTL64(din[1], c2[2]) ^ ROTL64(din[2], c2[3]) ^ ROTL64(din[3], c2[4]) ^ ROTL64(din[4], c2[5]) ^ ROTL64(din[5], c2[6])
-	dout[5] = din[5] ^ ROTL64(dout[6], c2[0]) ^ ROTL64(dout[7], c2[1]) ^ ROTL64(din[0], c2[2]) ^ ROTL64(din[1], c2[3]) ^ ROTL64(din[2], c2[4]) ^ ROTL64(din[3], c2[5]) ^ ROTL64(din[4], c2[6])
-	dout[4] = din[4] ^ ROTL64(dout[5], c2[0]) ^ ROTL64(dout[6], c2[1]) ^ ROTL64(dout[7], c2[2]) ^ ROTL64(din[0], c2[3]) ^ ROTL64(din[1], c2[4]) ^ ROTL64(din[2], c2[5]) ^ ROTL64(din[3], c2[6])
-	dout[3] = din[3] ^ ROTL64(dout[4], c2[0]) ^ ROTL64(dout[5], c2[1]) ^ ROTL64(dout[6], c2[2]) ^ ROTL64(dout[7], c2[3]) ^ ROTL64(din[0], c2[4]) ^ ROTL64(din[1], c2[5]) ^ ROTL64(din[2], c2[6])
-	dout[2] = din[2] ^ ROTL64(dout[3], c2[0]) ^ ROTL64(dout[4], c2[1]) ^ ROTL64(dout[5], c2[2]) ^ ROTL64(dout[6], c2[3]) ^ ROTL64(dout[7], c2[4]) ^ ROTL64(din[0], c2[5]) ^ ROTL64(din[1], c2[6])
-	dout[1] = din[1] ^ ROTL64(dout[2], c2[0]) ^ ROTL64(dout[3], c2[1]) ^ ROTL64(dout[4], c2[2]) ^ ROTL64(dout[5], c2[3]) ^ ROTL64(dout[6], c2[4]) ^ ROTL64(dout[7], c2[5]) ^ ROTL64(din[0], c2[6])
-	dout[0] = din[0] ^ ROTL64(dout[1], c2[0]) ^ ROTL64(dout[2], c2[1]) ^ ROTL64(dout[3], c2[2]) ^ ROTL64(dout[4], c2[3]) ^ ROTL64(dout[5], c2[4]) ^ ROTL64(dout[6], c2[5]) ^ ROTL64(dout[7], c2[6])
-}
-
-func DecryptOFB(data []uint8, rkey []uint8, klen int, blen int, res []uint8) {
-	var block [MAXBLOCKLEN]uint8
-	var block2 [MAXBLOCKLEN]uint8
-
-	copy(block[:], InvAddRk(data, rkey, int(RNDS(uint32(klen))-1), blen))
-	for i := int(RNDS(uint32(klen))) - 2; i > 0; i-- {
-		InvlinOp(unsafe.Pointer(&block[0]), unsafe.Pointer(&block2[0]), blen)
-		InvsBox(block2[:], block2[:], blen)
-		AddRkX(block2[:], rkey, i, blen, block[:])
-	}
-	InvlinOp(unsafe.Pointer(&block[0]), unsafe.Pointer(&block2[0]), blen)
-	InvsBox(block2[:], block2[:], blen)
-	out := InvAddRk(block2[:], rkey, 0, blen)
-	copy(res, out)
-}
-
-/* дополнение нулями/маркерами до кратности 16 */
-func myappend(buf []byte, used int) {
-	add := BLOCKLEN - used
-	if add == 0 {
-		buf[0] = 0x80
-		for i := 1; i < BLOCKLEN-1; i++ {
-			buf[i] = 0x00
-		}
-		buf[BLOCKLEN-1] = 0x01
-	} else if add == 1 {
-		buf[BLOCKLEN-1] = 0x81
-	} else {
-		buf[used] = 0x80
-		for i := 1; i < add-1; i++ {
-			buf[used+i] = 0x00
-		}
-		buf[BLOCKLEN-1] = 0x01
-	}
-}
-
-func EncryptOFB_File(dataLen int, rKey []byte, iv []byte, ostream io.Reader, sstream io.Writer) {
-	tmpBuf := make([]byte, BLOCKLEN)
-	streamBlock := make([]byte, BLOCKLEN)
-	plainBlock := make([]byte, BLOCKLEN)
-
-	copy(tmpBuf, iv)
-	total := 0
-
-	for {
-		n, err := io.ReadFull(ostream, plainBlock)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				if n == 0 {
-					break
-				}
-				myappend(plainBlock, n)
-			} else {
-				panic(fmt.Errorf("read failed: %w", err))
-			}
-		}
-
-		Encrypt(tmpBuf, rKey, DEFAULT_KEY_LEN, BLOCKLEN, streamBlock)
-		copy(tmpBuf, streamBlock)
-
-		for i := 0; i < BLOCKLEN; i++ {
-			streamBlock[i] ^= plainBlock[i]
-		}
-		if _, err := sstream.Write(streamBlock); err != nil {
-			panic(fmt.Errorf("write failed: %w", err))
-		}
-
-		total += BLOCKLEN
-		if total >= dataLen {
-			break
-		}
-	}
-}
-
-func DecryptOFB_File(dataLen int, rKey []byte, iv []byte, istream io.Reader, ostream io.Writer) error {
-	if dataLen%BLOCKLEN != 0 {
-		return fmt.Errorf("ciphertext length %d is not multiple of block size", dataLen)
-	}
-	nBlocks := dataLen / BLOCKLEN
-
-	tmp := make([]byte, BLOCKLEN) // previous keystream
-	ks := make([]byte, BLOCKLEN)  // current keystream
-	c := make([]byte, BLOCKLEN)   // ciphertext block
-	p := make([]byte, BLOCKLEN)   // plaintext block
-
-	copy(tmp, iv)
-	for b := 0; b < nBlocks; b++ {
-		Encrypt(tmp, rKey, DEFAULT_KEY_LEN, BLOCKLEN, ks)
-		copy(tmp, ks)
-
-		if _, err := io.ReadFull(istream, c); err != nil {
-			return fmt.Errorf("read ciphertext block %d: %w", b, err)
-		}
-		for i := 0; i < BLOCKLEN; i++ {
-			p[i] = ks[i] ^ c[i]
-		}
-
-		if b == nBlocks-1 {
-			rest := Myremove(&p[0])
-			if rest != BLOCKLEN {
-				if _, err := ostream.Write(p[:rest]); err != nil {
-					return fmt.Errorf("write last block: %w", err)
-				}
-			} else {
-				if _, err := ostream.Write(p); err != nil {
-					return fmt.Errorf("write last block: %w", err)
-				}
-			}
-		} else {
-			if _, err := ostream.Write(p); err != nil {
-				return fmt.Errorf("write block %d: %w", b, err)
-			}
-		}
-	}
-	return nil
-}
-
-func Qalqan_Imit(dataLen uint64, rKey []byte, ostream io.Reader, imit []uint8) {
-	var buf [BLOCKLEN]uint8
-	var acc [BLOCKLEN]uint8
-
-	readExact := func(dst []byte, n int) error {
-		_, err := io.ReadFull(ostream, dst[:n])
-		return err
-	}
-
-	if dataLen == 0 {
-		for i := 0; i < BLOCKLEN; i++ {
-			acc[i] = 0
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-		copy(imit[:BLOCKLEN], acc[:])
-		return
-	}
-
-	if dataLen >= BLOCKLEN {
-		_ = readExact(buf[:], BLOCKLEN)
-		Encrypt(buf[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	} else {
-		_ = readExact(buf[:], int(dataLen))
-		myappend(buf[:], int(dataLen))
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-		copy(imit[:BLOCKLEN], acc[:])
-		return
-	}
-
-	var i uint64
-	for i = BLOCKLEN; i+BLOCKLEN <= dataLen; i += BLOCKLEN {
-		_ = readExact(buf[:], BLOCKLEN)
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	}
-
-	if tail := int(dataLen - i); tail > 0 {
-		_ = readExact(buf[:], tail)
-		myappend(buf[:], tail)
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	}
-
-	copy(imit[:BLOCKLEN], acc[:BLOCKLEN])
-}
-
-func Qalqan_ImitData(dataLen uint64, rKey []byte, indata []uint8, imit []uint8) {
-	var buf [BLOCKLEN]uint8
-	var acc [BLOCKLEN]uint8
-
-	if dataLen == 0 {
-		for i := 0; i < BLOCKLEN; i++ {
-			acc[i] = 0
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-		copy(imit[:BLOCKLEN], acc[:])
-		return
-	}
-
-	if dataLen >= BLOCKLEN {
-		copy(buf[:], indata[:BLOCKLEN])
-		Encrypt(buf[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	} else {
-		copy(buf[:], indata[:dataLen])
-		myappend(buf[:], int(dataLen))
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-		copy(imit[:BLOCKLEN], acc[:])
-		return
-	}
-
-	var i uint64
-	for i = BLOCKLEN; i+BLOCKLEN <= dataLen; i += BLOCKLEN {
-		copy(buf[:], indata[i:i+BLOCKLEN])
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	}
-
-	if tail := int(dataLen - i); tail > 0 {
-		copy(buf[:tail], indata[i:i+uint64(tail)])
-		myappend(buf[:], tail)
-		for j := 0; j < BLOCKLEN; j++ {
-			acc[j] ^= buf[j]
-		}
-		Encrypt(acc[:], rKey, DEFAULT_KEY_LEN, BLOCKLEN, acc[:])
-	}
-
-	copy(imit[:BLOCKLEN], acc[:BLOCKLEN])
-}
-
-func Myremove(buf *uint8) int {
-	b := (*[BLOCKLEN]uint8)(unsafe.Pointer(buf))[:]
-	last := b[BLOCKLEN-1]
-	if last != 0x01 {
-		if last == 0x81 {
-			return BLOCKLEN - 1
-		}
-		return BLOCKLEN
-	}
-	i := BLOCKLEN - 2
-	for i >= 0 && b[i] == 0x00 {
-		i--
-	}
-	if i >= 0 && b[i] == 0x80 {
-		return i
-	}
-	return BLOCKLEN
-}
-
-func CreateFileMetadata(userNumber, fileType, keyType, circleKeyNumber, sessionKeyNumber byte) [16]byte {
-	var metadata [16]byte
-	metadata[0] = 0x00
-	metadata[1] = userNumber
-	metadata[2] = 0x04
-	metadata[3] = 0x20
-	metadata[4] = fileType
-	metadata[5] = keyType
-	metadata[6] = circleKeyNumber
-	metadata[7] = sessionKeyNumber
-
-	return metadata
-}
-
-func sanitizeName(name string) (string, error) {
-	base := filepath.Base(name)
-	if base == "." || base == "/" || base == "\\" || base == "" {
-		return "", errors.New("invalid file name")
-	}
-	if len([]byte(base)) > 255 {
-		return "", errors.New("file name too long")
-	}
-	return base, nil
-}
-
-func WriteHeader(w io.Writer, metadata [16]byte, origName string, origSize uint64) error {
-	bw := bufio.NewWriter(w)
-
-	if _, err := bw.Write(metadata[:]); err != nil {
-		return err
-	}
-	name, err := sanitizeName(origName)
-	if err != nil {
-		return err
-	}
-	nameBytes := []byte(name)
-	if len(nameBytes) > 0xFFFF {
-		return errors.New("file name too long")
-	}
-	var nameLen uint16 = uint16(len(nameBytes))
-	if err := binary.Write(bw, binary.LittleEndian, nameLen); err != nil {
-		return err
-	}
-	if _, err := bw.Write(nameBytes); err != nil {
-		return err
-	}
-	if err := binary.Write(bw, binary.LittleEndian, origSize); err != nil {
-		return err
-	}
-	return bw.Flush()
-}
-
-func ReadHeader(r io.Reader) (meta [16]byte, origName string, origSize uint64, headerLen int, err error) {
-	br := bufio.NewReader(r)
-
-	if _, err = io.ReadFull(br, meta[:]); err != nil {
-		return
-	}
-	headerLen += 16
-
-	var nameLen uint16
-	if err = binary.Read(br, binary.LittleEndian, &nameLen); err != nil {
-		return
-	}
-	headerLen += 2
-
-	if nameLen > 0 {
-		nameBytes := make([]byte, nameLen)
-		if _, err = io.ReadFull(br, nameBytes); err != nil {
-			return
-		}
-		origName = string(nameBytes)
-		headerLen += int(nameLen)
-	}
-
-	if err = binary.Read(br, binary.LittleEndian, &origSize); err != nil {
-		return
-	}
-	headerLen += 8
-
-	return
+package qalqan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+const (
+	KEXPSHIFT       = 17
+	RKEYLEN         = 16
+	BLOCKLEN        = 16
+	MAXBLOCKLEN     = 64
+	MINKEYLEN       = 32
+	MAXKEYLEN       = 128
+	KEYLENSTEP      = 16
+	MAXEXPKLEN      = 1024
+	DEFAULT_KEY_LEN = 32
+	EXPKLEN         = 272
+)
+
+/* Lin 32, Dif 4, PZh 7, deg 112, SAC 120 */
+var sb = [256]byte{
+	0xd1, 0xb5, 0xa6, 0x74, 0x2f, 0xb2, 0x03, 0x77, 0xae, 0xb3, 0x60, 0x95, 0xfd, 0xf8, 0xc7, 0xf0,
+	0x2b, 0xce, 0xa5, 0x91, 0x4c, 0x6f, 0xf3, 0x4f, 0x82, 0x01, 0x45, 0x76, 0x9f, 0xed, 0x41, 0xfb,
+	0xac, 0x4e, 0x5e, 0x04, 0xeb, 0xf9, 0xf1, 0x3a, 0x1f, 0xe2, 0x8e, 0xe7, 0x85, 0x35, 0xdb, 0x52,
+	0x78, 0xa1, 0xfc, 0xa2, 0xde, 0x68, 0x02, 0x4d, 0xf6, 0xdd, 0xcf, 0xa3, 0xdc, 0x6b, 0x81, 0x44,
+	0x2a, 0x5d, 0x1e, 0xe0, 0x53, 0x71, 0x3b, 0xc1, 0xcc, 0x9d, 0x80, 0xd5, 0x84, 0x00, 0x24, 0x4b,
+	0xb6, 0x83, 0x0d, 0x87, 0x7e, 0x86, 0xca, 0x96, 0xbe, 0x5a, 0xe6, 0xd0, 0xd4, 0xd8, 0x55, 0xc0,
+	0x05, 0xe5, 0xe9, 0x5b, 0x47, 0xe4, 0x2d, 0x34, 0x13, 0x88, 0x48, 0x32, 0x38, 0xb9, 0xda, 0xc9,
+	0x42, 0x29, 0xd7, 0xf2, 0x9b, 0x6d, 0xe8, 0x8d, 0x12, 0x7c, 0x8c, 0x3f, 0xbc, 0x3c, 0x1b, 0xc5,
+	0x69, 0x22, 0x97, 0xaa, 0x73, 0x0a, 0x0c, 0x8a, 0x90, 0x31, 0xc4, 0x33, 0xe1, 0x8b, 0x9c, 0x63,
+	0x5f, 0xf5, 0xf7, 0xff, 0x79, 0x49, 0xd3, 0xc6, 0x7b, 0x1a, 0x39, 0xc8, 0x6e, 0x72, 0xd9, 0xc3,
+	0x62, 0x28, 0xbd, 0xbb, 0xfa, 0x2e, 0xbf, 0x43, 0x06, 0x0b, 0x7a, 0x64, 0x5c, 0x92, 0x37, 0x3d,
+	0x66, 0x26, 0x51, 0xef, 0x0f, 0xa9, 0x14, 0x70, 0x16, 0x17, 0x10, 0x19, 0x93, 0x09, 0x59, 0x15,
+	0xfe, 0x4a, 0xcb, 0x2c, 0xcd, 0xb8, 0x94, 0xab, 0xdf, 0xa7, 0x0e, 0x30, 0xaf, 0x56, 0x23, 0xb1,
+	0xb0, 0x58, 0x7d, 0xc2, 0x1d, 0x50, 0x20, 0x61, 0x25, 0x89, 0xa0, 0x6c, 0x11, 0x54, 0x98, 0xb7,
+	0x18, 0x21, 0xad, 0x3e, 0xd2, 0xea, 0x40, 0xd6, 0xf4, 0xa4, 0x8f, 0xa8, 0x08, 0x57, 0xba, 0xee,
+	0x75, 0x6a, 0x07, 0x99, 0x7f, 0x1c, 0xe3, 0x46, 0x67, 0xec, 0x27, 0x36, 0xb4, 0x65, 0x9e, 0x9a,
+}
+
+var isb = [256]byte{
+	0x4d, 0x19, 0x36, 0x06, 0x23, 0x60, 0xa8, 0xf2, 0xec, 0xbd, 0x85, 0xa9, 0x86, 0x52, 0xca, 0xb4,
+	0xba, 0xdc, 0x78, 0x68, 0xb6, 0xbf, 0xb8, 0xb9, 0xe0, 0xbb, 0x99, 0x7e, 0xf5, 0xd4, 0x42, 0x28,
+	0xd6, 0xe1, 0x81, 0xce, 0x4e, 0xd8, 0xb1, 0xfa, 0xa1, 0x71, 0x40, 0x10, 0xc3, 0x66, 0xa5, 0x04,
+	0xcb, 0x89, 0x6b, 0x8b, 0x67, 0x2d, 0xfb, 0xae, 0x6c, 0x9a, 0x27, 0x46, 0x7d, 0xaf, 0xe3, 0x7b,
+	0xe6, 0x1e, 0x70, 0xa7, 0x3f, 0x1a, 0xf7, 0x64, 0x6a, 0x95, 0xc1, 0x4f, 0x14, 0x37, 0x21, 0x17,
+	0xd5, 0xb2, 0x2f, 0x44, 0xdd, 0x5e, 0xcd, 0xed, 0xd1, 0xbe, 0x59, 0x63, 0xac, 0x41, 0x22, 0x90,
+	0x0a, 0xd7, 0xa0, 0x8f, 0xab, 0xfd, 0xb0, 0xf8, 0x35, 0x80, 0xf1, 0x3d, 0xdb, 0x75, 0x9c, 0x15,
+	0xb7, 0x45, 0x9d, 0x84, 0x03, 0xf0, 0x1b, 0x07, 0x30, 0x94, 0xaa, 0x98, 0x79, 0xd2, 0x54, 0xf4,
+	0x4a, 0x3e, 0x18, 0x51, 0x4c, 0x2c, 0x55, 0x53, 0x69, 0xd9, 0x87, 0x8d, 0x7a, 0x77, 0x2a, 0xea,
+	0x88, 0x13, 0xad, 0xbc, 0xc6, 0x0b, 0x57, 0x82, 0xde, 0xf3, 0xff, 0x74, 0x8e, 0x49, 0xfe, 0x1c,
+	0xda, 0x31, 0x33, 0x3b, 0xe9, 0x12, 0x02, 0xc9, 0xeb, 0xb5, 0x83, 0xc7, 0x20, 0xe2, 0x08, 0xcc,
+	0xd0, 0xcf, 0x05, 0x09, 0xfc, 0x01, 0x50, 0xdf, 0xc5, 0x6d, 0xee, 0xa3, 0x7c, 0xa2, 0x58, 0xa6,
+	0x5f, 0x47, 0xd3, 0x9f, 0x8a, 0x7f, 0x97, 0x0e, 0x9b, 0x6f, 0x56, 0xc2, 0x48, 0xc4, 0x11, 0x3a,
+	0x5b, 0x00, 0xe4, 0x96, 0x5c, 0x4b, 0xe7, 0x72, 0x5d, 0x9e, 0x6e, 0x2e, 0x3c, 0x39, 0x34, 0xc8,
+	0x43, 0x8c, 0x29, 0xf6, 0x65, 0x61, 0x5a, 0x2b, 0x76, 0x62, 0xe5, 0x24, 0xf9, 0x1d, 0xef, 0xb3,
+	0x0f, 0x26, 0x73, 0x16, 0xe8, 0x91, 0x38, 0x92, 0x0d, 0x25, 0xa4, 0x1f, 0x32, 0x0c, 0xc0, 0x93,
+}
+
+func RNDS(x uint32) uint32 {
+	return 16 + (x-32)/16
+}
+
+func ExpKeyLen(klen int, blen int) int {
+	return int(RNDS(uint32(klen))) * blen
+}
+
+// Kexp writes the round keys of key for blen-byte blocks to rkey, which
+// must hold ExpKeyLen(klen, blen) bytes.
+//
+// Deprecated: use NewKey and Key.Expand, which check the lengths.
+func Kexp(key []byte, klen int, blen int, rkey []byte) {
+	var r0 [17]byte
+	var r1 [15]byte
+	addk := klen - 32
+	step := 0
+	s := KEXPSHIFT
+
+	for i := 0; i < 15; i++ {
+		r0[i] = key[2*i]
+		r1[i] = key[2*i+1]
+	}
+	r0[15] = key[30]
+	r0[16] = key[31]
+
+	nr := int(RNDS(uint32(klen)))
+	for r := 0; r < nr; r++ {
+		for k := 0; k < blen+s; k++ {
+			t0 := sb[r0[0]] + r0[1] + sb[r0[3]] + r0[7] + sb[r0[12]] + r0[16]
+			t1 := sb[r1[0]] + r1[3] + sb[r1[9]] + r1[12] + sb[r1[14]]
+
+			for i := 0; i < 14; i++ {
+				r0[i] = r0[i+1]
+				r1[i] = r1[i+1]
+			}
+			r0[14] = r0[15]
+			r0[15] = r0[16]
+
+			if k >= s {
+				rkey[r*blen+k-s] = t0 + r1[4]
+				if step < addk {
+					if (step & 1) == 1 {
+						t0 += key[32+step]
+					} else {
+						t1 += key[32+step]
+					}
+					step++
+				}
+			}
+
+			r0[16] = t0
+			r1[14] = t1
+		}
+		s = 0
+	}
+}
+
+func ROTL(x uint32, s uint32) uint32 {
+	s &= 31
+	return (x << s) | (x >> (32 - s))
+}
+func ROTL64(x uint64, s uint64) uint64 {
+	s &= 63
+	return (x << s) | (x >> (64 - s))
+}
+
+func Lin344(din, dout []uint32, c0 []uint32) {
+	if len(din) < 4 || len(dout) < 4 || len(c0) < 3 {
+		panic("Lin344: bad input lengths")
+	}
+	dout[0] = din[0] ^ ROTL(din[1], c0[0]) ^ ROTL(din[2], c0[1]) ^ ROTL(din[3], c0[2])
+	dout[1] = din[1] ^ ROTL(din[2], c0[0]) ^ ROTL(din[3], c0[1]) ^ ROTL(dout[0], c0[2])
+	dout[2] = din[2] ^ ROTL(din[3], c0[0]) ^ ROTL(dout[0], c0[1]) ^ ROTL(dout[1], c0[2])
+	dout[3] = din[3] ^ ROTL(dout[0], c0[0]) ^ ROTL(dout[1], c0[1]) ^ ROTL(dout[2], c0[2])
+}
+func Lin384(din, dout []uint32, c1 []uint32) {
+	dout[0] = din[0] ^ ROTL(din[1], c1[0]) ^ ROTL(din[2], c1[1]) ^ ROTL(din[3], c1[2]) ^ ROTL(din[4], c1[3]) ^ ROTL(din[5], c1[4]) ^ ROTL(din[6], c1[5]) ^ ROTL(din[7], c1[6])
+	dout[1] = din[1] ^ ROTL(din[2], c1[0]) ^ ROTL(din[3], c1[1]) ^ ROTL(din[4], c1[2]) ^ ROTL(din[5], c1[3]) ^ ROTL(din[6], c1[4]) ^ ROTL(din[7], c1[5]) ^ ROTL(dout[0], c1[6])
+	dout[2] = din[2] ^ ROTL(din[3], c1[0]) ^ ROTL(din[4], c1[1]) ^ ROTL(din[5], c1[2]) ^ ROTL(din[6], c1[3]) ^ ROTL(din[7], c1[4]) ^ ROTL(dout[0], c1[5]) ^ ROTL(dout[1], c1[6])
+	dout[3] = din[3] ^ ROTL(din[4], c1[0]) ^ ROTL(din[5], c1[1]) ^ ROTL(din[6], c1[2]) ^ ROTL(din[7], c1[3]) ^ ROTL(dout[0], c1[4]) ^ ROTL(dout[1], c1[5]) ^ ROTL(dout[2], c1[6])
+	dout[4] = din[4] ^ ROTL(din[5], c1[0]) ^ ROTL(din[6], c1[1]) ^ ROTL(din[7], c1[2]) ^ ROTL(dout[0], c1[3]) ^ ROTL(dout[1], c1[4]) ^ ROTL(dout[2], c1[5]) ^ ROTL(dout[3], c1[6])
+	dout[5] = din[5] ^ ROTL(din[6], c1[0]) ^ ROTL(din[7], c1[1]) ^ ROTL(dout[0], c1[2]) ^ ROTL(dout[1], c1[3]) ^ ROTL(dout[2], c1[4]) ^ ROTL(dout[3], c1[5]) ^ ROTL(dout[4], c1[6])
+	dout[6] = din[6] ^ ROTL(din[7], c1[0]) ^ ROTL(dout[0], c1[1]) ^ ROTL(dout[1], c1[2]) ^ ROTL(dout[2], c1[3]) ^ ROTL(dout[3], c1[4]) ^ ROTL(dout[4], c1[5]) ^ ROTL(dout[5], c1[6])
+	dout[7] = din[7] ^ ROTL(dout[0], c1[0]) ^ ROTL(dout[1], c1[1]) ^ ROTL(dout[2], c1[2]) ^ ROTL(dout[3], c1[3]) ^ ROTL(dout[4], c1[4]) ^ ROTL(dout[5], c1[5]) ^ ROTL(dout[6], c1[6])
+}
+func Lin388(din, dout []uint64, c2 []uint64) {
+	dout[0] = din[0] ^ ROTL64(din[1], c2[0]) ^ ROTL64(din[2], c2[1]) ^ ROTL64(din[3], c2[2]) ^ ROTL64(din[4], c2[3]) ^ ROTL64(din[5], c2[4]) ^ ROTL64(din[6], c2[5]) ^ ROTL64(din[7], c2[6])
+	dout[1] = din[1] ^ ROTL64(din[2], c2[0]) ^ ROTL64(din[3], c2[1]) ^ ROTL64(din[4], c2[2]) ^ ROTL64(din[5], c2[3]) ^ ROTL64(din[6], c2[4]) ^ ROTL64(din[7], c2[5]) ^ ROTL64(dout[0], c2[6])
+	dout[2] = din[2] ^ ROTL64(din[3], c2[0]) ^ ROTL64(din[4], c2[1]) ^ ROTL64(din[5], c2[2]) ^ ROTL64(din[6], c2[3]) ^ ROTL64(din[7], c2[4]) ^ ROTL64(dout[0], c2[5]) ^ ROTL64(dout[1], c2[6])
+	dout[3] = din[3] ^ ROTL64(din[4], c2[0]) ^ ROTL64(din[5], c2[1]) ^ ROTL64(din[6], c2[2]) ^ ROTL64(din[7], c2[3]) ^ ROTL64(dout[0], c2[4]) ^ ROTL64(dout[1], c2[5]) ^ ROTL64(dout[2], c2[6])
+	dout[4] = din[4] ^ ROTL64(din[5], c2[0]) ^ ROTL64(din[6], c2[1]) ^ ROTL64(din[7], c2[2]) ^ ROTL64(dout[0], c2[3]) ^ ROTL64(dout[1], c2[4]) ^ ROTL64(dout[2], c2[5]) ^ ROTL64(dout[3], c2[6])
+	dout[5] = din[5] ^ ROTL64(din[6], c2[0]) ^ ROTL64(din[7], c2[1]) ^ ROTL64(dout[0], c2[2]) ^ ROTL64(dout[1], c2[3]) ^ ROTL64(dout[2], c2[4]) ^ ROTL64(dout[3], c2[5]) ^ ROTL64(dout[4], c2[6])
+	dout[6] = din[6] ^ ROTL64(din[7], c2[0]) ^ ROTL64(dout[0], c2[1]) ^ ROTL64(dout[1], c2[2]) ^ ROTL64(dout[2], c2[3]) ^ ROTL64(dout[3], c2[4]) ^ ROTL64(dout[4], c2[5]) ^ ROTL64(dout[5], c2[6])
+	dout[7] = din[7] ^ ROTL64(dout[0], c2[0]) ^ ROTL64(dout[1], c2[1]) ^ ROTL64(dout[2], c2[2]) ^ ROTL64(dout[3], c2[3]) ^ ROTL64(dout[4], c2[4]) ^ ROTL64(dout[5], c2[5]) ^ ROTL64(dout[6], c2[6])
+}
+
+// Block is the state the round functions work on. Only the first blocklen
+// bytes are used; words are loaded and stored little-endian whatever the
+// byte order of the host.
+type Block [MAXBLOCKLEN]byte
+
+var (
+	lin344C = []uint32{1, 17, 14}
+	lin384C = []uint32{3, 5, 11, 21, 16, 30, 19}
+	lin388C = []uint64{4, 0, 22, 27, 47, 4, 61}
+)
+
+func load32(w []uint32, b []byte) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+}
+func store32(b []byte, w []uint32) {
+	for i := range w {
+		binary.LittleEndian.PutUint32(b[4*i:], w[i])
+	}
+}
+func load64(w []uint64, b []byte) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint64(b[8*i:])
+	}
+}
+func store64(b []byte, w []uint64) {
+	for i := range w {
+		binary.LittleEndian.PutUint64(b[8*i:], w[i])
+	}
+}
+
+func LinOp(d, r *Block, blocklen int) {
+	switch blocklen {
+	case 16:
+		var in, out [4]uint32
+		load32(in[:], d[:])
+		Lin344(in[:], out[:], lin344C)
+		store32(r[:], out[:])
+	case 32:
+		var in, out [8]uint32
+		load32(in[:], d[:])
+		Lin384(in[:], out[:], lin384C)
+		store32(r[:], out[:])
+	case 64:
+		var in, out [8]uint64
+		load64(in[:], d[:])
+		Lin388(in[:], out[:], lin388C)
+		store64(r[:], out[:])
+	default:
+		panic("LinOp: unexpected block length")
+	}
+}
+func InvlinOp(d, r *Block, blocklen int) {
+	switch blocklen {
+	case 16:
+		var in, out [4]uint32
+		load32(in[:], d[:])
+		Ilin344(in[:], out[:], lin344C)
+		store32(r[:], out[:])
+	case 32:
+		var in, out [8]uint32
+		load32(in[:], d[:])
+		Ilin384(in[:], out[:], lin384C)
+		store32(r[:], out[:])
+	case 64:
+		var in, out [8]uint64
+		load64(in[:], d[:])
+		Ilin388(in[:], out[:], lin388C)
+		store64(r[:], out[:])
+	default:
+		panic("InvlinOp: unexpected block length")
+	}
+}
+
+func sBox(data, res []uint8, blen int, sb []byte) {
+	for i := 0; i < blen; i++ {
+		res[i] = sb[data[i]]
+	}
+}
+func InvsBox(data, res []uint8, blen int) {
+	for i := 0; i < blen; i++ {
+		res[i] = isb[data[i]]
+	}
+}
+func AddRkX(block, rkey []uint8, nr, blen int, res []uint8) {
+	for i := 0; i < blen; i++ {
+		res[i] = block[i] ^ rkey[nr*blen+i]
+	}
+}
+func AddRk(block, rkey []uint8, nr, blen int, res []uint8) {
+	tmp := uint16(block[0]) + uint16(rkey[blen*nr])
+	res[0] = uint8(tmp)
+	tmp >>= 8
+	for i := 1; i < blen; i++ {
+		tmp += uint16(block[i]) + uint16(rkey[blen*nr+i])
+		res[i] = uint8(tmp)
+		tmp >>= 8
+	}
+}
+
+// Encrypt encrypts one blen-byte block with round keys made by Kexp.
+//
+// Deprecated: use ExpandedKey.Encrypt.
+func Encrypt(data, rkey []uint8, klen int, blen int, res []uint8) {
+	expandedRoundKeys(rkey, klen, blen).Encrypt(res, data)
+}
+
+func InvAddRk(block, rkey []uint8, nr int, blen int) []uint8 {
+	res := make([]byte, blen)
+	tmp := int(block[0]) - int(rkey[blen*nr])
+	res[0] = uint8(tmp)
+	tmp >>= 8
+	for i := 1; i < blen; i++ {
+		tmp += int(block[i]) - int(rkey[blen*nr+i])
+		res[i] = uint8(tmp)
+		tmp >>= 8
+	}
+	return res
+}
+
+func Ilin344(din, dout []uint32, c0 []uint32) {
+	dout[3] = din[3] ^ ROTL(din[0], c0[0]) ^ ROTL(din[1], c0[1]) ^ ROTL(din[2], c0[2])
+	dout[2] = din[2] ^ ROTL(dout[3], c0[0]) ^ ROTL(din[0], c0[1]) ^ ROTL(din[1], c0[2])
+	dout[1] = din[1] ^ ROTL(dout[2], c0[0]) ^ ROTL(dout[3], c0[1]) ^ ROTL(din[0], c0[2])
+	dout[0] = din[0] ^ ROTL(dout[1], c0[0]) ^ ROTL(dout[2], c0[1]) ^ ROTL(dout[3], c0[2])
+}
+func Ilin384(din, dout []uint32, c1 []uint32) {
+	dout[7] = din[7] ^ ROTL(din[0], c1[0]) ^ ROTL(din[1], c1[1]) ^ ROTL(din[2], c1[2]) ^ ROTL(din[3], c1[3]) ^ ROTL(din[4], c1[4]) ^ ROTL(din[5], c1[5]) ^ ROTL(din[6], c1[6])
+	dout[6] = din[6] ^ ROTL(dout[7], c1[0]) ^ ROTL(din[0], c1[1]) ^ ROTL(din[1], c1[2]) ^ ROTL(din[2], c1[3]) ^ ROTL(din[3], c1[4]) ^ ROTL(din[4], c1[5]) ^ ROTL(din[5], c1[6])
+	dout[5] = din[5] ^ ROTL(dout[6], c1[0]) ^ ROTL(dout[7], c1[1]) ^ ROTL(din[0], c1[2]) ^ ROTL(din[1], c1[3]) ^ ROTL(din[2], c1[4]) ^ ROTL(din[3], c1[5]) ^ ROTL(din[4], c1[6])
+	dout[4] = din[4] ^ ROTL(dout[5], c1[0]) ^ ROTL(dout[6], c1[1]) ^ ROTL(dout[7], c1[2]) ^ ROTL(din[0], c1[3]) ^ ROTL(din[1], c1[4]) ^ ROTL(din[2], c1[5]) ^ ROTL(din[3], c1[6])
+	dout[3] = din[3] ^ ROTL(dout[4], c1[0]) ^ ROTL(dout[5], c1[1]) ^ ROTL(dout[6], c1[2]) ^ ROTL(dout[7], c1[3]) ^ ROTL(din[0], c1[4]) ^ ROTL(din[1], c1[5]) ^ ROTL(din[2], c1[6])
+	dout[2] = din[2] ^ ROTL(dout[3], c1[0]) ^ ROTL(dout[4], c1[1]) ^ ROTL(dout[5], c1[2]) ^ ROTL(dout[6], c1[3]) ^ ROTL(dout[7], c1[4]) ^ ROTL(din[0], c1[5]) ^ ROTL(din[1], c1[6])
+	dout[1] = din[1] ^ ROTL(dout[2], c1[0]) ^ ROTL(dout[3], c1[1]) ^ ROTL(dout[4], c1[2]) ^ ROTL(dout[5], c1[3]) ^ ROTL(dout[6], c1[4]) ^ ROTL(dout[7], c1[5]) ^ ROTL(din[0], c1[6])
+	dout[0] = din[0] ^ ROTL(dout[1], c1[0]) ^ ROTL(dout[2], c1[1]) ^ ROTL(dout[3], c1[2]) ^ ROTL(dout[4], c1[3]) ^ ROTL(dout[5], c1[4]) ^ ROTL(dout[6], c1[5]) ^ ROTL(dout[7], c1[6])
+}
+func Ilin388(din, dout []uint64, c2 []uint64) {
+	dout[7] = din[7] ^ ROTL64(din[0], c2[0]) ^ ROTL64(din[1], c2[1]) ^ ROTL64(din[2], c2[2]) ^ ROTL64(din[3], c2[3]) ^ ROTL64(din[4], c2[4]) ^ ROTL64(din[5], c2[5]) ^ ROTL64(din[6], c2[6])
+	dout[6] = din[6] ^ ROTL64(dout[7], c2[0]) ^ ROTL64(din[0], c2[1]) ^ ROTL64(din[1], c2[2]) ^ ROTL64(din[2], c2[3]) ^ ROTL64(din[3], c2[4]) ^ ROTL64(din[4], c2[5]) ^ ROTL64(din[5], c2[6])
+	dout[5] = din[5] ^ ROTL64(dout[6], c2[0]) ^ ROTL64(dout[7], c2[1]) ^ ROTL64(din[0], c2[2]) ^ ROTL64(din[1], c2[3]) ^ ROTL64(din[2], c2[4]) ^ ROTL64(din[3], c2[5]) ^ ROTL64(din[4], c2[6])
+	dout[4] = din[4] ^ ROTL64(dout[5], c2[0]) ^ ROTL64(dout[6], c2[1]) ^ ROTL64(dout[7], c2[2]) ^ ROTL64(din[0], c2[3]) ^ ROTL64(din[1], c2[4]) ^ ROTL64(din[2], c2[5]) ^ ROTL64(din[3], c2[6])
+	dout[3] = din[3] ^ ROTL64(dout[4], c2[0]) ^ ROTL64(dout[5], c2[1]) ^ ROTL64(dout[6], c2[2]) ^ ROTL64(dout[7], c2[3]) ^ ROTL64(din[0], c2[4]) ^ ROTL64(din[1], c2[5]) ^ ROTL64(din[2], c2[6])
+	dout[2] = din[2] ^ ROTL64(dout[3], c2[0]) ^ ROTL64(dout[4], c2[1]) ^ ROTL64(dout[5], c2[2]) ^ ROTL64(dout[6], c2[3]) ^ ROTL64(dout[7], c2[4]) ^ ROTL64(din[0], c2[5]) ^ ROTL64(din[1], c2[6])
+	dout[1] = din[1] ^ ROTL64(dout[2], c2[0]) ^ ROTL64(dout[3], c2[1]) ^ ROTL64(dout[4], c2[2]) ^ ROTL64(dout[5], c2[3]) ^ ROTL64(dout[6], c2[4]) ^ ROTL64(dout[7], c2[5]) ^ ROTL64(din[0], c2[6])
+	dout[0] = din[0] ^ ROTL64(dout[1], c2[0]) ^ ROTL64(dout[2], c2[1]) ^ ROTL64(dout[3], c2[2]) ^ ROTL64(dout[4], c2[3]) ^ ROTL64(dout[5], c2[4]) ^ ROTL64(dout[6], c2[5]) ^ ROTL64(dout[7], c2[6])
+}
+
+// DecryptOFB decrypts one blen-byte block with round keys made by Kexp.
+//
+// Deprecated: use ExpandedKey.Decrypt.
+func DecryptOFB(data []uint8, rkey []uint8, klen int, blen int, res []uint8) {
+	expandedRoundKeys(rkey, klen, blen).Decrypt(res, data)
+}
+
+/* дополнение нулями/маркерами до кратности 16 */
+func myappend(buf []byte, used int) {
+	add := BLOCKLEN - used
+	if add == 0 {
+		buf[0] = 0x80
+		for i := 1; i < BLOCKLEN-1; i++ {
+			buf[i] = 0x00
+		}
+		buf[BLOCKLEN-1] = 0x01
+	} else if add == 1 {
+		buf[BLOCKLEN-1] = 0x81
+	} else {
+		buf[used] = 0x80
+		for i := 1; i < add-1; i++ {
+			buf[used+i] = 0x00
+		}
+		buf[BLOCKLEN-1] = 0x01
+	}
+}
+
+// EncryptOFB_File encrypts up to dataLen bytes of ostream to sstream in OFB
+// mode and returns the first read or write error.
+//
+// Deprecated: use NewOFBWriter, or WriteFile for .qlq files.
+func EncryptOFB_File(dataLen int, rKey []byte, klen int, iv []byte, ostream io.Reader, sstream io.Writer) error {
+	tmpBuf := make([]byte, BLOCKLEN)
+	streamBlock := make([]byte, BLOCKLEN)
+	plainBlock := make([]byte, BLOCKLEN)
+
+	copy(tmpBuf, iv)
+	total := 0
+
+	for {
+		n, err := io.ReadFull(ostream, plainBlock)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if n == 0 {
+					break
+				}
+				myappend(plainBlock, n)
+			} else {
+				return fmt.Errorf("read failed: %w", err)
+			}
+		}
+
+		Encrypt(tmpBuf, rKey, klen, BLOCKLEN, streamBlock)
+		copy(tmpBuf, streamBlock)
+
+		for i := 0; i < BLOCKLEN; i++ {
+			streamBlock[i] ^= plainBlock[i]
+		}
+		if _, err := sstream.Write(streamBlock); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+
+		total += BLOCKLEN
+		if total >= dataLen {
+			break
+		}
+	}
+	return nil
+}
+
+// Deprecated: use NewReader with ModeOFB, or OpenFile for .qlq files.
+func DecryptOFB_File(dataLen int, rKey []byte, klen int, iv []byte, istream io.Reader, ostream io.Writer) error {
+	if dataLen%BLOCKLEN != 0 {
+		return fmt.Errorf("ciphertext length %d is not a multiple of the block size: %w", dataLen, ErrTruncated)
+	}
+	nBlocks := dataLen / BLOCKLEN
+
+	tmp := make([]byte, BLOCKLEN) // previous keystream
+	ks := make([]byte, BLOCKLEN)  // current keystream
+	c := make([]byte, BLOCKLEN)   // ciphertext block
+	p := make([]byte, BLOCKLEN)   // plaintext block
+
+	copy(tmp, iv)
+	for b := 0; b < nBlocks; b++ {
+		Encrypt(tmp, rKey, klen, BLOCKLEN, ks)
+		copy(tmp, ks)
+
+		if _, err := io.ReadFull(istream, c); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrTruncated
+			}
+			return fmt.Errorf("read ciphertext block %d: %w", b, err)
+		}
+		for i := 0; i < BLOCKLEN; i++ {
+			p[i] = ks[i] ^ c[i]
+		}
+
+		if b == nBlocks-1 {
+			rest := Myremove((*[BLOCKLEN]byte)(p))
+			if rest != BLOCKLEN {
+				if _, err := ostream.Write(p[:rest]); err != nil {
+					return fmt.Errorf("write last block: %w", err)
+				}
+			} else {
+				if _, err := ostream.Write(p); err != nil {
+					return fmt.Errorf("write last block: %w", err)
+				}
+			}
+		} else {
+			if _, err := ostream.Write(p); err != nil {
+				return fmt.Errorf("write block %d: %w", b, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Qalqan_Imit computes the imit of the next dataLen bytes of ostream into
+// imit. If ostream fails or ends early it returns the error and leaves imit
+// unchanged.
+//
+// Deprecated: use NewMAC.
+func Qalqan_Imit(dataLen uint64, rKey []byte, klen int, ostream io.Reader, imit []uint8) error {
+	m := &MAC{b: expandedRoundKeys(rKey, klen, BLOCKLEN)}
+	if n, err := io.CopyN(m, ostream, int64(dataLen)); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("imit: read %d of %d bytes: %w", n, dataLen, ErrTruncated)
+		}
+		return fmt.Errorf("read failed: %w", err)
+	}
+	copy(imit[:BLOCKLEN], m.Sum(nil))
+	return nil
+}
+
+// Deprecated: use NewMAC.
+func Qalqan_ImitData(dataLen uint64, rKey []byte, klen int, indata []uint8, imit []uint8) {
+	m := &MAC{b: expandedRoundKeys(rKey, klen, BLOCKLEN)}
+	m.Write(indata[:dataLen])
+	copy(imit[:BLOCKLEN], m.Sum(nil))
+}
+
+func Myremove(b *[BLOCKLEN]byte) int {
+	last := b[BLOCKLEN-1]
+	if last != 0x01 {
+		if last == 0x81 {
+			return BLOCKLEN - 1
+		}
+		return BLOCKLEN
+	}
+	i := BLOCKLEN - 2
+	for i >= 0 && b[i] == 0x00 {
+		i--
+	}
+	if i >= 0 && b[i] == 0x80 {
+		return i
+	}
+	return BLOCKLEN
+}
+
+func CreateFileMetadata(userNumber, recipient, keyLen, fileType, keyType, circleKeyNumber, sessionKeyNumber, mode byte) [16]byte {
+	var metadata [16]byte
+	metadata[0] = 0x00
+	metadata[1] = userNumber
+	metadata[2] = 0x04
+	metadata[3] = keyLen
+	metadata[4] = fileType
+	metadata[5] = keyType
+	metadata[6] = circleKeyNumber
+	metadata[7] = sessionKeyNumber
+	metadata[8] = mode
+	metadata[9] = recipient
+
+	return metadata
+}
+
+func sanitizeName(name string) (string, error) {
+	base := filepath.Base(name)
+	if base == "." || base == "/" || base == "\\" || base == "" {
+		return "", errors.New("invalid file name")
+	}
+	if len([]byte(base)) > 255 {
+		return "", errors.New("file name too long")
+	}
+	return base, nil
+}
+
+func WriteHeader(w io.Writer, metadata [16]byte, origName string, origSize uint64) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := bw.Write(metadata[:]); err != nil {
+		return err
+	}
+	name, err := sanitizeName(origName)
+	if err != nil {
+		return err
+	}
+	nameBytes := []byte(name)
+	if len(nameBytes) > 0xFFFF {
+		return errors.New("file name too long")
+	}
+	var nameLen uint16 = uint16(len(nameBytes))
+	if err := binary.Write(bw, binary.LittleEndian, nameLen); err != nil {
+		return err
+	}
+	if _, err := bw.Write(nameBytes); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, origSize); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func ReadHeader(r io.Reader) (meta [16]byte, origName string, origSize uint64, headerLen int, err error) {
+	br := bufio.NewReader(r)
+
+	if _, err = io.ReadFull(br, meta[:]); err != nil {
+		return
+	}
+	headerLen += 16
+
+	var nameLen uint16
+	if err = binary.Read(br, binary.LittleEndian, &nameLen); err != nil {
+		return
+	}
+	headerLen += 2
+
+	if nameLen > 0 {
+		nameBytes := make([]byte, nameLen)
+		if _, err = io.ReadFull(br, nameBytes); err != nil {
+			return
+		}
+		origName = string(nameBytes)
+		headerLen += int(nameLen)
+	}
+
+	if err = binary.Read(br, binary.LittleEndian, &origSize); err != nil {
+		return
+	}
+	headerLen += 8
+
+	return
 }
\ No newline at end of file
@@ -0,0 +1,510 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Known-answer vectors recorded from the reference implementation. Keys are
+// 0x00, 0x01, ...; block plaintexts are 0xff, 0xee, ... and MAC/OFB data is
+// 0x01, 0x04, 0x07, ...
+var blockKAT = []struct {
+	klen, blen int
+	rkeySHA256 string
+	ciphertext string
+}{
+	{32, 16, "08609346d8bbd491ec0c88af866ced6142f8dfea91f50420a17f0c368cb16d94", "1d91a748dd4bf0d7d566eaa14cfe44b0"},
+	{32, 32, "596ddfb04f690a3652d41391dbd993fa731332d78643501a8a58f1c5e4c7a2c4", "997f2f468d42b9252987e3d25f6589264bddbdf25dfec180e62754e66d1bfcf4"},
+	{32, 64, "30ced5532ca3c755414b2b75749a78b4c6eefc314d12fc426bd378691cac184a", "a19ed8b0ee02009914edc31790074f14a16dabeeb3452c4ffe86e1fe90e2f9c17b3863665e114180da9662b63057376db8a44d4f54bda92a128a05611187f3ea"},
+	{48, 16, "343e44a866c727ed789a7e02ea49a6a748195c3e3d875bcfdf6cddd01bd5b98b", "1fe41c3cd20466f79dcea737ab6eef78"},
+	{48, 32, "25ecd835443ef1b30135dbf099c10cb6ceb40fbea3edbd43d9072f7252d1f098", "af2d99200d3bc114c1a8321a76c33050dd4b9dd85c9917d5f9e112196ce7d83e"},
+	{48, 64, "b47314d4ba355ebdb0d4561df7930a5e6f0da0f2e2ccd4b85c916783cc28351a", "1278c5ec478761261036747e5e6afc34342aa2901e627755e7a59c548bdae7e94ee33354ca136bb6d55bfc2af02d79e98052acb286ecbed4cf24549e80aaec16"},
+	{64, 16, "2a6cb51edd8d5730a5e809fbd1bb11c4bd441072ed413cd28620acbfa1c63127", "baa7fc307fccbd08e59b270d24712173"},
+	{64, 32, "6e940558bc4e9d7630ab922318a8aceb6730a478236faa4a351f45ac090e088e", "b3a6502cd48f03addf3e8a2b03195d2ff3adf2c11e7402b40e77e11591cfd260"},
+	{64, 64, "ebf3626e2f58f3d8ded322a5da4783d7a104e8a4042246ec3e7531dc6bacd46d", "085290e20ef01b655d0f3296b2bcac6447910a0ecc2d8f241bf1bd0bc3b561d2d8def8ef7b0b4a2e5c80c8da7534b1d54d06e13b2ce95abf6a42c34c1c76e862"},
+	{80, 16, "846da42508deb9971c260aaf7f936ee869743add35bc8b1d0e8562bf1746035d", "793aead0ce4aa8be2e123155b2a55f01"},
+	{80, 32, "e90c507fce65568731b0aa55c3968a2d28b9d91e89708a587ac74b7e57c65aa7", "c281d78f851a7d9d5f829d083fa74bad8a5cf629cbbfb6cf98fb5d78f0d555b8"},
+	{80, 64, "10d6dd3e2075f01d0625b32c39e3bdd6207577903301507bd8858574ddd29708", "2e05327800aad620b625a11e788d64400ad52f610a61e520c45596ab6d4d1b7d996fd686a1adb5229ceccfc335bc426be9bb2ff8afb29337fe3459b5c5255f3e"},
+	{96, 16, "71f90c6a434e169b723507ddb08a466ab7e552d1df50a70ccfc1bcb438f13d6a", "535823c4c397ba25bcca494a7f0460b7"},
+	{96, 32, "b72d8549fa4498173376ce2141cf73dfae31c62aef70110df42691cffc226a4b", "6e7cc7f64801ef5646b7492a37ca6821440141dcfebfd69f7252a5319d120135"},
+	{96, 64, "49d472e3e1051e58ca7d33722704352273f40984228eccf66dbd0938a7ce38be", "759f9d58d2f691be807f64e1e4eff2d6110cb0100292eef9d83938ac48a37bf560bb2a96bdb4ee99d540ddf5e250b7d36c8debde06771547bebd9748481856a0"},
+	{112, 16, "8be9f7aa511eba8e44318b9049967b9f2a5cb438d95ff661d1f3bd9f5908ad01", "2fab039dc6483dd9a6449104e2e36f3a"},
+	{112, 32, "1737bb956aa79b9d4b6c278316f89da75cf0e5e2c754ffbd7815557d94445328", "899cd27a1c3fe5eba181cbd0ab99db5146387503da8042c868c616a402269c46"},
+	{112, 64, "4e3565fd973e1eea99ba9f6555a243289fa978476fe590c2163e8d118861d1a6", "e45f39e06737c51331bfcd9bce6590904feb3a8a0bf38c6e0b8d2b28aae97a02b8cc087a744687883ff50172d031db00d68a72a8f3ec91b2141ee32f5785d310"},
+	{128, 16, "f376b13fd282e7e8f033aa71f12440a156856310922d24e604e559acd68b2780", "09b0495ee4138b6aae0f37490a447c84"},
+	{128, 32, "6be4e79f9721509f245babb382b99244a125bd178338a9362a9f8609cfcd2066", "7d79d9190098ca7c047bb65f3425b6e27ce20baac524142868304119a75914e9"},
+	{128, 64, "17fda939ac9aa7c5a5d032650a252199d72b99535219ae5d1e17bba7918d2710", "e17aabade5f4facf67fd614f9e5b7c8318e115750ae7ffe7e3b13ede7bb5c1a93099946f400563f87087b3080152fbced78945b92392785acc2ff462c2342bb3"},
+}
+
+var imitKAT = []struct {
+	klen, dataLen int
+	imit          string
+}{
+	{32, 0, "8a0cb138d5cc4fae591c597d2e7838cf"},
+	{32, 1, "8ebfbbca75cb4ac9663f80c8f08a8540"},
+	{32, 15, "a8a31bfa340e2bbd1f964496c97b5cbd"},
+	{32, 16, "fd8ff9e12ebbd7a330572f578d5b6f28"},
+	{32, 17, "6dbeaec8f311ce9035ffd3aebc19a662"},
+	{32, 48, "fa510406f2ab5567caefc066cdd269c9"},
+	{32, 100, "5519deb02dcee81b098206acd5a2bc9a"},
+	{64, 0, "df0e805b4165221ae793826a9f671bba"},
+	{64, 1, "6c70d21d7bf58ba51c34bf4825aba845"},
+	{64, 15, "cbc701150a35c0438ed870d83f756670"},
+	{64, 16, "1c2a9d1268030c949a587f4a185c8741"},
+	{64, 17, "b981dfb9bbb55237d2ef469b0fddcabb"},
+	{64, 48, "5db1ef333bc4818e839cbca442326fd0"},
+	{64, 100, "4b99d200c26d18530acc377cb6e0d533"},
+	{128, 0, "20bad2159564a2c891f163510faa45fd"},
+	{128, 1, "8ada24c0877fc46a235ca94ef36f52b5"},
+	{128, 15, "34639eefbabbbac15fe30af164d001d4"},
+	{128, 16, "ce4b9968e6691494ef51a9d9847e7555"},
+	{128, 17, "621bc57564d23d41c982f9e644012a24"},
+	{128, 48, "2f3f3d52fea879e631c0eb96ee827e55"},
+	{128, 100, "f876aa91189ea95ec9e764a5cab3ece5"},
+}
+
+// OFB vectors use a 32-byte key and katPlain(16) as IV.
+var ofbKAT = []struct {
+	dataLen    int
+	ciphertext string
+}{
+	{0, ""},
+	{5, "1c95a042d0cbf0d7d566eaa14cfe44b1"},
+	{16, "1c95a042d05be3c1cc7af58369d66f9e"},
+	{33, "1c95a042d05be3c1cc7af58369d66f9edcfa989707844539821a5f38ed611e07056e12c42fb23f13a54e052725553a13"},
+}
+
+// LinOp vectors over katPlain(64).
+var linKAT = []struct {
+	blen int
+	out  string
+}{
+	{16, "26f38c5914f09c782f8f3e9ec9d2ebf0"},
+	{32, "68d9ff908744adf247ea774fc00378eed5bcf55ce9d4c78371a4ca7a78c3b71a"},
+	{64, "5743af7e868a0a7bd40ad384bfc25a79e4df7158e44a6d6ce44180d57684a494554d9a6513a01a5d89f31a1d764e27e5e64410eeabc8a26d5ab4d85b5a96c3af"},
+}
+
+func katKey(klen int) []byte {
+	key := make([]byte, klen)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func katPlain(blen int) []byte {
+	p := make([]byte, blen)
+	for i := range p {
+		p[i] = byte(0xff - i*0x11)
+	}
+	return p
+}
+
+func katData(n int) []byte {
+	d := make([]byte, n)
+	for i := range d {
+		d[i] = byte(i*3 + 1)
+	}
+	return d
+}
+
+func expand(key []byte, blen int) []byte {
+	rkey := make([]byte, ExpKeyLen(len(key), blen))
+	Kexp(key, len(key), blen, rkey)
+	return rkey
+}
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBlockKAT(t *testing.T) {
+	for _, v := range blockKAT {
+		rkey := expand(katKey(v.klen), v.blen)
+		sum := sha256.Sum256(rkey)
+		if got := hex.EncodeToString(sum[:]); got != v.rkeySHA256 {
+			t.Errorf("Kexp klen=%d blen=%d: round keys hash %s, want %s", v.klen, v.blen, got, v.rkeySHA256)
+		}
+
+		pt := katPlain(v.blen)
+		ct := make([]byte, v.blen)
+		Encrypt(pt, rkey, v.klen, v.blen, ct)
+		if want := mustHex(t, v.ciphertext); !bytes.Equal(ct, want) {
+			t.Errorf("Encrypt klen=%d blen=%d: got %x, want %x", v.klen, v.blen, ct, want)
+		}
+
+		back := make([]byte, v.blen)
+		DecryptOFB(ct, rkey, v.klen, v.blen, back)
+		if !bytes.Equal(back, pt) {
+			t.Errorf("DecryptOFB klen=%d blen=%d: got %x, want %x", v.klen, v.blen, back, pt)
+		}
+
+		b, err := NewCipher(katKey(v.klen), v.blen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Encrypt(back, pt)
+		if !bytes.Equal(back, ct) {
+			t.Errorf("NewCipher klen=%d blen=%d: got %x, want %x", v.klen, v.blen, back, ct)
+		}
+	}
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	for klen := MINKEYLEN; klen <= MAXKEYLEN; klen += KEYLENSTEP {
+		for _, blen := range []int{16, 32, 64} {
+			key := make([]byte, klen)
+			for i := range key {
+				key[i] = byte(i*29 + klen)
+			}
+			rkey := expand(key, blen)
+			block := make([]byte, blen)
+			for n := 0; n < 64; n++ {
+				for i := range block {
+					block[i] = byte(n*blen + i*17)
+				}
+				ct := make([]byte, blen)
+				back := make([]byte, blen)
+				Encrypt(block, rkey, klen, blen, ct)
+				DecryptOFB(ct, rkey, klen, blen, back)
+				if !bytes.Equal(back, block) {
+					t.Fatalf("klen=%d blen=%d: round trip failed for %x", klen, blen, block)
+				}
+			}
+		}
+	}
+}
+
+func TestLinOpKAT(t *testing.T) {
+	var in, out, back Block
+	copy(in[:], katPlain(MAXBLOCKLEN))
+	for _, v := range linKAT {
+		LinOp(&in, &out, v.blen)
+		if want := mustHex(t, v.out); !bytes.Equal(out[:v.blen], want) {
+			t.Errorf("LinOp blen=%d: got %x, want %x", v.blen, out[:v.blen], want)
+		}
+		InvlinOp(&out, &back, v.blen)
+		if !bytes.Equal(back[:v.blen], in[:v.blen]) {
+			t.Errorf("InvlinOp blen=%d: got %x, want %x", v.blen, back[:v.blen], in[:v.blen])
+		}
+	}
+}
+
+func TestLinIlinPairs(t *testing.T) {
+	c0 := []uint32{1, 17, 14}
+	c1 := []uint32{3, 5, 11, 21, 16, 30, 19}
+	c2 := []uint64{4, 0, 22, 27, 47, 4, 61}
+	for n := uint32(0); n < 256; n++ {
+		in32 := make([]uint32, 8)
+		in64 := make([]uint64, 8)
+		for i := range in32 {
+			in32[i] = n*0x9e3779b9 + uint32(i)*0x7f4a7c15
+			in64[i] = uint64(in32[i])<<32 | uint64(^in32[i])
+		}
+		out32 := make([]uint32, 8)
+		back32 := make([]uint32, 8)
+		Lin344(in32, out32, c0)
+		Ilin344(out32, back32, c0)
+		if !equalWords(back32[:4], in32[:4]) {
+			t.Fatalf("Ilin344(Lin344(%x)) = %x", in32[:4], back32[:4])
+		}
+		Lin384(in32, out32, c1)
+		Ilin384(out32, back32, c1)
+		if !equalWords(back32, in32) {
+			t.Fatalf("Ilin384(Lin384(%x)) = %x", in32, back32)
+		}
+		out64 := make([]uint64, 8)
+		back64 := make([]uint64, 8)
+		Lin388(in64, out64, c2)
+		Ilin388(out64, back64, c2)
+		if !equalWords(back64, in64) {
+			t.Fatalf("Ilin388(Lin388(%x)) = %x", in64, back64)
+		}
+	}
+}
+
+func equalWords[T uint32 | uint64](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMyappendMyremove(t *testing.T) {
+	for used := 0; used <= BLOCKLEN; used++ {
+		buf := bytes.Repeat([]byte{0xaa}, BLOCKLEN)
+		myappend(buf, used)
+		want := used
+		if used == BLOCKLEN {
+			want = 0
+		}
+		if got := Myremove((*[BLOCKLEN]byte)(buf)); got != want {
+			t.Errorf("used=%d: Myremove = %d, want %d (block %x)", used, got, want, buf)
+		}
+	}
+
+	for _, tc := range []struct {
+		block string
+		want  int
+	}{
+		{"000102030405060708090a0b0c0d0e0f", BLOCKLEN},
+		{"00000000000000000000000000000081", BLOCKLEN - 1},
+		{"80000000000000000000000000000001", 0},
+		{"00000000000000000000000000000001", BLOCKLEN},
+		{"11111111111111111111118000000001", 11},
+	} {
+		b := mustHex(t, tc.block)
+		if got := Myremove((*[BLOCKLEN]byte)(b)); got != tc.want {
+			t.Errorf("Myremove(%s) = %d, want %d", tc.block, got, tc.want)
+		}
+	}
+}
+
+func TestImitKAT(t *testing.T) {
+	for _, v := range imitKAT {
+		rkey := expand(katKey(v.klen), BLOCKLEN)
+		data := katData(v.dataLen)
+		want := mustHex(t, v.imit)
+
+		imit := make([]byte, BLOCKLEN)
+		if err := Qalqan_Imit(uint64(v.dataLen), rkey, v.klen, bytes.NewReader(data), imit); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(imit, want) {
+			t.Errorf("Qalqan_Imit klen=%d len=%d: got %x, want %x", v.klen, v.dataLen, imit, want)
+		}
+		Qalqan_ImitData(uint64(v.dataLen), rkey, v.klen, data, imit)
+		if !bytes.Equal(imit, want) {
+			t.Errorf("Qalqan_ImitData klen=%d len=%d: got %x, want %x", v.klen, v.dataLen, imit, want)
+		}
+
+		b, err := NewCipher(katKey(v.klen), BLOCKLEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac, err := NewMAC(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(mac, iotest.OneByteReader(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		if got := mac.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("MAC klen=%d len=%d: got %x, want %x", v.klen, v.dataLen, got, want)
+		}
+	}
+}
+
+func TestImitReadErrors(t *testing.T) {
+	rkey := expand(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	imit := make([]byte, BLOCKLEN)
+	if err := Qalqan_Imit(100, rkey, DEFAULT_KEY_LEN, bytes.NewReader(katData(99)), imit); !errors.Is(err, ErrTruncated) {
+		t.Errorf("short read: err = %v, want ErrTruncated", err)
+	}
+	boom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader(katData(50)), iotest.ErrReader(boom))
+	if err := Qalqan_Imit(100, rkey, DEFAULT_KEY_LEN, r, imit); !errors.Is(err, boom) {
+		t.Errorf("read error: err = %v, want %v", err, boom)
+	}
+	if !bytes.Equal(imit, make([]byte, BLOCKLEN)) {
+		t.Errorf("imit written after a failed read: %x", imit)
+	}
+}
+
+func TestOFBFileKAT(t *testing.T) {
+	rkey := expand(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	iv := katPlain(BLOCKLEN)
+	for _, v := range ofbKAT {
+		data := katData(v.dataLen)
+		want := mustHex(t, v.ciphertext)
+
+		var ct bytes.Buffer
+		if err := EncryptOFB_File(v.dataLen, rkey, DEFAULT_KEY_LEN, iv, bytes.NewReader(data), &ct); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ct.Bytes(), want) {
+			t.Errorf("EncryptOFB_File len=%d: got %x, want %x", v.dataLen, ct.Bytes(), want)
+		}
+
+		var pt bytes.Buffer
+		if err := DecryptOFB_File(len(want), rkey, DEFAULT_KEY_LEN, iv, bytes.NewReader(want), &pt); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pt.Bytes(), data) {
+			t.Errorf("DecryptOFB_File len=%d: got %x, want %x", v.dataLen, pt.Bytes(), data)
+		}
+	}
+
+	boom := errors.New("boom")
+	if err := EncryptOFB_File(64, rkey, DEFAULT_KEY_LEN, iv, iotest.ErrReader(boom), io.Discard); !errors.Is(err, boom) {
+		t.Errorf("EncryptOFB_File read error: err = %v, want %v", err, boom)
+	}
+	if err := EncryptOFB_File(64, rkey, DEFAULT_KEY_LEN, iv, bytes.NewReader(katData(64)), failWriter{boom}); !errors.Is(err, boom) {
+		t.Errorf("EncryptOFB_File write error: err = %v, want %v", err, boom)
+	}
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestModesRoundTrip(t *testing.T) {
+	b, err := NewCipher(katKey(48), BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := katPlain(BLOCKLEN)
+	for _, mode := range []Mode{ModeOFB, ModeECB, ModeCBC, ModeCTR} {
+		for _, n := range []int{0, 1, 15, 16, 17, streamBufSize - 1, streamBufSize, streamBufSize + 1} {
+			data := katData(n)
+
+			var ct bytes.Buffer
+			w, err := NewWriter(&ct, mode, b, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(iotest.HalfReader(&ct), mode, b, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%v len=%d: %v", mode, n, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%v len=%d: round trip mismatch", mode, n)
+			}
+		}
+	}
+}
+
+// TestModesKeepPaddingLookalikes checks that aligned data whose last bytes
+// look like padding survives the modes that always pad.
+func TestModesKeepPaddingLookalikes(t *testing.T) {
+	b, err := NewCipher(katKey(48), BLOCKLEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := katPlain(BLOCKLEN)
+	for _, mode := range []Mode{ModeECB, ModeCBC, ModeCTR} {
+		for _, n := range []int{16, 32, streamBufSize} {
+			data := katData(n)
+			data[n-1] = 0x81
+
+			var ct bytes.Buffer
+			w, err := NewWriter(&ct, mode, b, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := NewReader(&ct, mode, b, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%v len=%d: %v", mode, n, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%v len=%d: got %d bytes back", mode, n, len(got))
+			}
+		}
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	meta := CreateFileMetadata(1, 2, DEFAULT_KEY_LEN, 0x77, 0x01, 3, 42, byte(ModeCBC))
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, meta, "dir/report.pdf", 123456); err != nil {
+		t.Fatal(err)
+	}
+	gotMeta, name, size, n, err := ReadHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotMeta != meta || name != "report.pdf" || size != 123456 || n != 16+2+len("report.pdf")+8 {
+		t.Fatalf("ReadHeader = %x %q %d %d", gotMeta, name, size, n)
+	}
+}
+
+func BenchmarkKexp(b *testing.B) {
+	key := katKey(DEFAULT_KEY_LEN)
+	rkey := make([]byte, ExpKeyLen(DEFAULT_KEY_LEN, BLOCKLEN))
+	for i := 0; i < b.N; i++ {
+		Kexp(key, DEFAULT_KEY_LEN, BLOCKLEN, rkey)
+	}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	for _, blen := range []int{16, 32, 64} {
+		b.Run(fmt.Sprintf("blen=%d", blen), func(b *testing.B) {
+			rkey := expand(katKey(DEFAULT_KEY_LEN), blen)
+			block := katPlain(blen)
+			b.SetBytes(int64(blen))
+			for i := 0; i < b.N; i++ {
+				Encrypt(block, rkey, DEFAULT_KEY_LEN, blen, block)
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptOFB(b *testing.B) {
+	rkey := expand(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	block := katPlain(BLOCKLEN)
+	b.SetBytes(BLOCKLEN)
+	for i := 0; i < b.N; i++ {
+		DecryptOFB(block, rkey, DEFAULT_KEY_LEN, BLOCKLEN, block)
+	}
+}
+
+func BenchmarkImit(b *testing.B) {
+	rkey := expand(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	data := katData(64 << 10)
+	imit := make([]byte, BLOCKLEN)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		Qalqan_ImitData(uint64(len(data)), rkey, DEFAULT_KEY_LEN, data, imit)
+	}
+}
+
+func BenchmarkOFBWriter(b *testing.B) {
+	block, err := NewCipher(katKey(DEFAULT_KEY_LEN), BLOCKLEN)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := katData(1 << 20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		w, _ := NewOFBWriter(io.Discard, block, katPlain(BLOCKLEN))
+		w.Write(data)
+		w.Close()
+	}
+}
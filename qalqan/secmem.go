@@ -0,0 +1,68 @@
+package qalqan
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// SecureBuffer holds key material. Its pages are locked against swapping
+// where the platform allows it, and Release zeroes it.
+type SecureBuffer struct {
+	mu     sync.Mutex
+	b      []byte
+	region []byte
+	locked bool
+}
+
+// NewSecureBuffer returns a zeroed buffer of n bytes. If the memory cannot
+// be locked, for example because RLIMIT_MEMLOCK is exhausted, the buffer is
+// still usable and zeroed on release; Locked reports false.
+func NewSecureBuffer(n int) *SecureBuffer {
+	if n == 0 {
+		return &SecureBuffer{b: []byte{}}
+	}
+	// Round the buffer out to whole pages it does not share with other
+	// allocations, so unlocking it cannot unlock someone else's data.
+	page := os.Getpagesize()
+	size := (n + page - 1) / page * page
+	alloc := make([]byte, size+page)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&alloc[0])) % uintptr(page)); rem != 0 {
+		off = page - rem
+	}
+	s := &SecureBuffer{
+		b:      alloc[off : off+n : off+n],
+		region: alloc[off : off+size],
+	}
+	s.locked = lockMemory(s.region) == nil
+	return s
+}
+
+// Bytes returns the buffer contents. The slice must not be used after
+// Release.
+func (s *SecureBuffer) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b
+}
+
+// Locked reports whether the buffer is locked in memory.
+func (s *SecureBuffer) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// Release zeroes and unlocks the buffer. It is safe to call more than once.
+func (s *SecureBuffer) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.region)
+	clear(s.b)
+	if s.locked {
+		unlockMemory(s.region)
+		s.locked = false
+	}
+	s.b, s.region = nil, nil
+}
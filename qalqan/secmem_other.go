@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package qalqan
+
+import "errors"
+
+func lockMemory(b []byte) error {
+	return errors.New("memory locking is not supported on this platform")
+}
+
+func unlockMemory(b []byte) error {
+	return nil
+}
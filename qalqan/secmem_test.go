@@ -0,0 +1,50 @@
+package qalqan
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestSecureBuffer(t *testing.T) {
+	for _, n := range []int{0, 1, 32, os.Getpagesize(), os.Getpagesize() + 1} {
+		s := NewSecureBuffer(n)
+		b := s.Bytes()
+		if len(b) != n || cap(b) != n {
+			t.Fatalf("n=%d: len %d cap %d", n, len(b), cap(b))
+		}
+		if n == 0 {
+			s.Release()
+			continue
+		}
+		if p := uintptr(unsafe.Pointer(&b[0])); p%uintptr(os.Getpagesize()) != 0 {
+			t.Fatalf("n=%d: buffer at %#x is not page aligned", n, p)
+		}
+		t.Logf("n=%d: locked=%v", n, s.Locked())
+
+		for i := range b {
+			b[i] = 0xA5
+		}
+		s.Release()
+		if !bytes.Equal(b, make([]byte, n)) {
+			t.Fatalf("n=%d: Release left data behind", n)
+		}
+		if s.Bytes() != nil || s.Locked() {
+			t.Fatalf("n=%d: buffer still usable after Release", n)
+		}
+		s.Release()
+	}
+}
+
+func TestKeySetWipeZeroesKeys(t *testing.T) {
+	ks := loadKeySet(t, writeKeySet(t, cheapHeader(t, 32), "secret", 1))
+	imit := ks.ImitKey.(*ExpandedKey)
+	keys := [][]byte{ks.kikey, ks.Circle[0], ks.Session[0][99], imit.rk}
+	ks.Wipe()
+	for i, k := range keys {
+		if !bytes.Equal(k, make([]byte, len(k))) {
+			t.Fatalf("key %d not wiped", i)
+		}
+	}
+}
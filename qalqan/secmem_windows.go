@@ -0,0 +1,17 @@
+//go:build windows
+
+package qalqan
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func lockMemory(b []byte) error {
+	return windows.VirtualLock(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+}
+
+func unlockMemory(b []byte) error {
+	return windows.VirtualUnlock(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+}
@@ -0,0 +1,154 @@
+package qalqan
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Power-on self-test vectors, a subset of the known-answer tests. Keys are
+// 0x00, 0x01, ...; block plaintexts are 0xff, 0xee, ... and imit data is
+// 0x01, 0x04, 0x07, ...
+var (
+	selfTestCipher = []struct {
+		klen, blen int
+		ciphertext string
+	}{
+		{32, 16, "1d91a748dd4bf0d7d566eaa14cfe44b0"},
+		{64, 32, "b3a6502cd48f03addf3e8a2b03195d2ff3adf2c11e7402b40e77e11591cfd260"},
+		{128, 64, "e17aabade5f4facf67fd614f9e5b7c8318e115750ae7ffe7e3b13ede7bb5c1a93099946f400563f87087b3080152fbced78945b92392785acc2ff462c2342bb3"},
+	}
+	selfTestImit = []struct {
+		klen, dataLen int
+		imit          string
+	}{
+		{32, 17, "6dbeaec8f311ce9035ffd3aebc19a662"},
+		{128, 100, "f876aa91189ea95ec9e764a5cab3ece5"},
+	}
+	selfTestKDF = []struct {
+		header *KeyFileHeader
+		key    string
+	}{
+		{&KeyFileHeader{Version: KeyFileLegacy, KDF: KDFHash512}, "3dd6e976577884f22378edb795a86609f6f383a902dc4b11f66276fb992fbaf0"},
+		{&KeyFileHeader{Version: KeyFileV1, KDF: KDFArgon2id, KeyLen: 32, Threads: 1, Time: 1, Memory: 64}, "687fd5c9cb4e63b2237bbe7f1ae5ebd2c8018baf552e5c0252ba32a27f751638"},
+	}
+)
+
+// selfTestRandLen is the size of each crypto/rand sample the health check
+// compares.
+const selfTestRandLen = 64
+
+// SelfTest runs the power-on self-test: cipher, imit and key derivation
+// known-answer tests and a health check of crypto/rand. The error wraps
+// ErrSelfTest; no key should be used after it fails.
+func SelfTest() error {
+	for _, check := range []struct {
+		name string
+		run  func() error
+	}{
+		{"cipher", selfTestCiphers},
+		{"imit", selfTestImits},
+		{"KDF", selfTestKDFs},
+		{"RNG", func() error { return selfTestRand(rand.Reader) }},
+	} {
+		if err := check.run(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSelfTest, check.name, err)
+		}
+	}
+	return nil
+}
+
+func selfTestPattern(n int, start, step byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)*step
+	}
+	return b
+}
+
+func selfTestCiphers() error {
+	for _, v := range selfTestCipher {
+		want, err := hex.DecodeString(v.ciphertext)
+		if err != nil {
+			return err
+		}
+		b, err := NewCipher(selfTestPattern(v.klen, 0, 1), v.blen)
+		if err != nil {
+			return err
+		}
+		plain := selfTestPattern(v.blen, 0xff, 0xef)
+		got := make([]byte, v.blen)
+		b.Encrypt(got, plain)
+		if !bytes.Equal(got, want) {
+			wipeBlock(b)
+			return fmt.Errorf("encrypt with %d-byte key, %d-byte block: known answer mismatch", v.klen, v.blen)
+		}
+		b.Decrypt(got, got)
+		wipeBlock(b)
+		if !bytes.Equal(got, plain) {
+			return fmt.Errorf("decrypt with %d-byte key, %d-byte block: known answer mismatch", v.klen, v.blen)
+		}
+	}
+	return nil
+}
+
+func selfTestImits() error {
+	for _, v := range selfTestImit {
+		want, err := hex.DecodeString(v.imit)
+		if err != nil {
+			return err
+		}
+		b, err := NewCipher(selfTestPattern(v.klen, 0, 1), BLOCKLEN)
+		if err != nil {
+			return err
+		}
+		mac, err := NewMAC(b)
+		if err != nil {
+			return err
+		}
+		mac.Write(selfTestPattern(v.dataLen, 1, 3))
+		got := mac.Sum(nil)
+		wipeBlock(b)
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("%d-byte key, %d bytes of data: known answer mismatch", v.klen, v.dataLen)
+		}
+	}
+	return nil
+}
+
+func selfTestKDFs() error {
+	for _, v := range selfTestKDF {
+		h := *v.header
+		copy(h.Salt[:], selfTestPattern(kdfSaltLen, 1, 3))
+		key := h.UnlockKey("password")
+		got := hex.EncodeToString(key.Bytes())
+		key.Release()
+		if got != v.key {
+			return fmt.Errorf("KDF 0x%02X: known answer mismatch", h.KDF)
+		}
+	}
+	return nil
+}
+
+// selfTestRand reads two samples from r and rejects a failing reader, a
+// sample stuck at one byte value and a sample that repeats the previous one.
+func selfTestRand(r io.Reader) error {
+	var prev []byte
+	for i := 0; i < 2; i++ {
+		sample := make([]byte, selfTestRandLen)
+		if _, err := io.ReadFull(r, sample); err != nil {
+			return err
+		}
+		if bytes.Count(sample, sample[:1]) == len(sample) {
+			return fmt.Errorf("sample is stuck at 0x%02X", sample[0])
+		}
+		if bytes.Equal(sample, prev) {
+			return errors.New("sample repeats the previous one")
+		}
+		prev = sample
+	}
+	return nil
+}
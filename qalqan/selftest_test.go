@@ -0,0 +1,62 @@
+package qalqan
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelfTestVectorsMatchKAT(t *testing.T) {
+	if !bytes.Equal(selfTestPattern(64, 0, 1), katKey(64)) ||
+		!bytes.Equal(selfTestPattern(64, 0xff, 0xef), katPlain(64)) ||
+		!bytes.Equal(selfTestPattern(100, 1, 3), katData(100)) {
+		t.Fatal("self-test patterns differ from the KAT inputs")
+	}
+}
+
+func TestSelfTestDetectsBadVectors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		vector *string
+	}{
+		{"cipher", &selfTestCipher[1].ciphertext},
+		{"imit", &selfTestImit[0].imit},
+		{"KDF", &selfTestKDF[1].key},
+	} {
+		saved := *tc.vector
+		*tc.vector = strings.Repeat("0", len(saved))
+		err := SelfTest()
+		*tc.vector = saved
+		if !errors.Is(err, ErrSelfTest) || !strings.Contains(err.Error(), tc.name) {
+			t.Errorf("%s vector corrupted: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestSelfTestRand(t *testing.T) {
+	random := bytes.Repeat(katData(selfTestRandLen), 2)
+	random[selfTestRandLen] ^= 1
+	if err := selfTestRand(bytes.NewReader(random)); err != nil {
+		t.Fatalf("healthy source rejected: %v", err)
+	}
+	for name, r := range map[string]*bytes.Reader{
+		"stuck":    bytes.NewReader(make([]byte, 2*selfTestRandLen)),
+		"repeated": bytes.NewReader(bytes.Repeat(katData(selfTestRandLen), 2)),
+		"short":    bytes.NewReader(katData(selfTestRandLen + 1)),
+	} {
+		if err := selfTestRand(r); err == nil {
+			t.Errorf("%s source accepted", name)
+		}
+	}
+	if err := selfTestRand(iotest.ErrReader(errors.New("no entropy"))); err == nil {
+		t.Error("failing source accepted")
+	}
+}
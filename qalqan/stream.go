@@ -0,0 +1,187 @@
+package qalqan
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const streamBufSize = 32 * 1024
+
+var errWriterClosed = errors.New("write to closed writer")
+
+// Writer encrypts everything written to it. The final partial block is
+// padded with myappend on Close, exactly as EncryptOFB_File does; CTR and
+// the block modes also get a full padding block when the data is block
+// aligned.
+type Writer struct {
+	dst     io.Writer
+	crypt   func(dst, src []byte)
+	padFull bool
+	buf     []byte
+	n       int
+	err     error
+	closed  bool
+}
+
+// Reader decrypts a stream produced by Writer and strips the padding of the
+// final block.
+type Reader struct {
+	src     io.Reader
+	crypt   func(dst, src []byte)
+	padFull bool
+	buf     []byte
+	n       int
+	hold    [BLOCKLEN]byte
+	held    bool
+	out     []byte
+	err     error
+}
+
+// NewOFBWriter returns a Writer that encrypts to w in OFB mode. Close must be
+// called to write the last block; it does not close w.
+func NewOFBWriter(w io.Writer, b cipher.Block, iv []byte) (*Writer, error) {
+	return NewWriter(w, ModeOFB, b, iv)
+}
+
+// NewOFBReader returns a Reader that decrypts OFB ciphertext read from r.
+func NewOFBReader(r io.Reader, b cipher.Block, iv []byte) (*Reader, error) {
+	return NewReader(r, ModeOFB, b, iv)
+}
+
+func newWriter(w io.Writer, crypt func(dst, src []byte), padFull bool, size int) *Writer {
+	return &Writer{
+		dst:     w,
+		crypt:   crypt,
+		padFull: padFull,
+		buf:     make([]byte, size),
+	}
+}
+
+func newReader(r io.Reader, crypt func(dst, src []byte), padFull bool, size int) *Reader {
+	return &Reader{
+		src:     r,
+		crypt:   crypt,
+		padFull: padFull,
+		buf:     make([]byte, size),
+	}
+}
+
+// unpad returns the payload length of the final block. Like DecryptOFB_File,
+// OFB takes a block without a valid padding marker as a whole, which loses
+// aligned data that happens to end like padding; in CTR and the block modes
+// the final block always carries padding.
+func (r *Reader) unpad(block []byte) (int, error) {
+	rest := Myremove((*[BLOCKLEN]byte)(block))
+	if rest == BLOCKLEN && r.padFull {
+		return 0, ErrBadPadding
+	}
+	return rest, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		m := copy(w.buf[w.n:], p)
+		w.n += m
+		written += m
+		p = p[m:]
+		if w.n == len(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close pads and writes the final block.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if rem := w.n % BLOCKLEN; rem > 0 || w.padFull {
+		full := w.n - rem
+		myappend(w.buf[full:full+BLOCKLEN], rem)
+		w.n = full + BLOCKLEN
+	}
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	w.crypt(w.buf[:w.n], w.buf[:w.n])
+	if _, err := w.dst.Write(w.buf[:w.n]); err != nil {
+		w.err = fmt.Errorf("write failed: %w", err)
+		return w.err
+	}
+	w.n = 0
+	return nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// fill decrypts the next chunk of ciphertext. The last block read is always
+// held back until the following read shows whether it ends the stream.
+func (r *Reader) fill() {
+	if r.held {
+		r.n = copy(r.buf, r.hold[:])
+		r.held = false
+	}
+	m, err := io.ReadFull(r.src, r.buf[r.n:])
+	r.n += m
+
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		if r.n%BLOCKLEN != 0 {
+			r.err = fmt.Errorf("ciphertext length is not a multiple of the block size: %w", ErrTruncated)
+			return
+		}
+		if r.n == 0 {
+			r.err = io.EOF
+			if r.padFull {
+				r.err = fmt.Errorf("ciphertext has no padding block: %w", ErrTruncated)
+			}
+			return
+		}
+		r.crypt(r.buf[:r.n], r.buf[:r.n])
+		last := r.n - BLOCKLEN
+		rest, perr := r.unpad(r.buf[last:r.n])
+		if perr != nil {
+			r.err = perr
+			return
+		}
+		r.out = r.buf[:last+rest]
+		r.n = 0
+		r.err = io.EOF
+	case err != nil:
+		r.err = fmt.Errorf("read failed: %w", err)
+	default:
+		k := r.n - BLOCKLEN
+		r.crypt(r.buf[:k], r.buf[:k])
+		copy(r.hold[:], r.buf[k:r.n])
+		r.held = true
+		r.out = r.buf[:k]
+		r.n = 0
+	}
+}
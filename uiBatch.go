@@ -0,0 +1,268 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	batchPerFile = "One .qlq per file"
+	batchArchive = "Single archive"
+)
+
+// newFileHeader picks a key of keyType ("Circular" or "Session") and returns
+// it with a CTR header for a file from the own user to recipient.
+func newFileHeader(keys *qalqan.KeyStore, keyType string, recipient int) (*qalqan.FileHeader, cipher.Block, error) {
+	switch keyType {
+	case "Circular":
+		return keys.NewFileHeader(qalqan.KeyTypeCircle, recipient)
+	case "Session":
+		return keys.NewFileHeader(qalqan.KeyTypeSession, recipient)
+	}
+	return nil, nil, fmt.Errorf("invalid key type selected: %s", keyType)
+}
+
+// showBatchEncryptDialog collects files and folders and encrypts them into
+// one archive or into one .qlq per file.
+func showBatchEncryptDialog(myWindow fyne.Window, keys *qalqan.KeyStore, logs *widget.RichText, keyType string, recipient int, onDone func()) {
+	setLog := func(text string) {
+		logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: text, Style: widget.RichTextStyleInline}}
+		logs.Refresh()
+	}
+
+	// The file dialogs pick one item at a time, so the selection is built
+	// up in a list; folders are added with everything below them.
+	var paths []string
+	list := widget.NewList(
+		func() int { return len(paths) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(paths[i]) },
+	)
+	add := func(path string) {
+		for _, p := range paths {
+			if p == path {
+				return
+			}
+		}
+		paths = append(paths, path)
+		list.Refresh()
+	}
+	addFile := widget.NewButtonWithIcon("Add file", theme.FileIcon(), func() {
+		dialog.ShowFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil {
+				setLog("Error opening file: " + err.Error())
+				return
+			}
+			if r == nil {
+				return
+			}
+			r.Close()
+			add(r.URI().Path())
+		}, myWindow)
+	})
+	addFolder := widget.NewButtonWithIcon("Add folder", theme.FolderIcon(), func() {
+		dialog.ShowFolderOpen(func(u fyne.ListableURI, err error) {
+			if err != nil {
+				setLog("Error opening folder: " + err.Error())
+				return
+			}
+			if u != nil {
+				add(u.Path())
+			}
+		}, myWindow)
+	})
+	output := widget.NewRadioGroup([]string{batchPerFile, batchArchive}, nil)
+	output.SetSelected(batchPerFile)
+	selection := container.NewVScroll(list)
+	selection.SetMinSize(fyne.NewSize(420, 160))
+	content := container.NewBorder(container.NewHBox(addFile, addFolder), output, nil, nil, selection)
+
+	dialog.ShowCustomConfirm("Encrypt files and folders", "Next", "Cancel", content, func(ok bool) {
+		if !ok || len(paths) == 0 {
+			return
+		}
+		files, err := qalqan.CollectArchiveFiles(paths...)
+		if err != nil {
+			setLog("Failed to read the selection: " + err.Error())
+			return
+		}
+		if output.Selected == batchArchive {
+			name := "archive"
+			if len(paths) == 1 {
+				name = filepath.Base(paths[0])
+			}
+			saveArchive(myWindow, keys, files, name, keyType, recipient, setLog, onDone)
+			return
+		}
+		dialog.ShowFolderOpen(func(dst fyne.ListableURI, err error) {
+			if err != nil {
+				setLog("Error opening folder: " + err.Error())
+				return
+			}
+			if dst == nil {
+				return
+			}
+			n, err := encryptEach(keys, files, dst.Path(), keyType, recipient)
+			onDone()
+			if err != nil {
+				setLog(fmt.Sprintf("Encrypted %d files, then failed: %s", n, errorText(err)))
+				return
+			}
+			setLog(fmt.Sprintf("%d files encrypted to %s", n, dst.Path()))
+		}, myWindow)
+	}, myWindow)
+}
+
+func saveArchive(myWindow fyne.Window, keys *qalqan.KeyStore, files []qalqan.ArchiveFile, name, keyType string, recipient int, setLog func(string), onDone func()) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			setLog("Error saving file: " + err.Error())
+			return
+		}
+		if writer == nil {
+			return
+		}
+		var h *qalqan.FileHeader
+		imitKey, err := keys.ImitKey()
+		if err == nil {
+			var fileKey cipher.Block
+			h, fileKey, err = newFileHeader(keys, keyType, recipient)
+			if err == nil {
+				h.Name = name
+				err = qalqan.EncryptArchive(writer, h, imitKey, fileKey, files)
+			}
+		}
+		if cerr := writer.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			storage.Delete(writer.URI())
+			releaseKey(keys, h)
+			setLog("Failed to save encrypted archive: " + errorText(err))
+			return
+		}
+		if h.KeyType == qalqan.KeyTypeSession {
+			if err := keys.CommitSessionKey(h.SessionKey); err != nil {
+				setLog("Archive encrypted, but the key usage ledger was not updated: " + err.Error())
+				return
+			}
+		}
+		onDone()
+		setLog(fmt.Sprintf("%d entries encrypted into %s", len(files), writer.URI().Name()))
+	}, myWindow)
+	saveDialog.SetFileName(name + ".qlq")
+	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".qlq"}))
+	saveDialog.Show()
+}
+
+// encryptEach encrypts every file of files to its own .qlq below dst,
+// recreating the directory tree, and returns how many were written.
+func encryptEach(keys *qalqan.KeyStore, files []qalqan.ArchiveFile, dst, keyType string, recipient int) (int, error) {
+	imitKey, err := keys.ImitKey()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if f.Dir {
+			continue
+		}
+		out := filepath.Join(dst, filepath.FromSlash(f.Name)) + ".qlq"
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return n, err
+		}
+		h, fileKey, err := newFileHeader(keys, keyType, recipient)
+		if err != nil {
+			return n, err
+		}
+		h.FileType = qalqan.FileTypeFor(f.Name)
+		h.Name = filepath.Base(f.Path)
+		h.Size = f.Size
+		if err := encryptTo(out, f.Path, h, imitKey, fileKey); err != nil {
+			releaseKey(keys, h)
+			return n, err
+		}
+		if h.KeyType == qalqan.KeyTypeSession {
+			if err := keys.CommitSessionKey(h.SessionKey); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// releaseKey gives back the session key of h, if it took one, after the
+// file it was meant for could not be written.
+func releaseKey(keys *qalqan.KeyStore, h *qalqan.FileHeader) {
+	if h != nil && h.KeyType == qalqan.KeyTypeSession {
+		keys.ReleaseSessionKey(h.SessionKey)
+	}
+}
+
+func encryptTo(out, path string, h *qalqan.FileHeader, imitKey, fileKey cipher.Block) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	w, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = qalqan.WriteChunkedFile(w, h, imitKey, fileKey, src)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+	}
+	return err
+}
+
+// restoreArchive asks for a folder and extracts the archive in file there.
+// It closes src, the file that file reads from, once it is done.
+func restoreArchive(myWindow fyne.Window, logs *widget.RichText, file *qalqan.File, fileKey cipher.Block, src io.Closer) {
+	setLog := func(text string) {
+		logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: text, Style: widget.RichTextStyleInline}}
+		logs.Refresh()
+	}
+	ra, err := file.NewReaderAt(fileKey)
+	if err != nil {
+		src.Close()
+		setLog("Decryption failed: " + errorText(err))
+		return
+	}
+	archive, err := qalqan.ReadArchive(ra, ra.Size())
+	if err != nil {
+		src.Close()
+		setLog("Invalid archive: " + errorText(err))
+		return
+	}
+	dialog.ShowFolderOpen(func(dst fyne.ListableURI, err error) {
+		defer src.Close()
+		if err != nil {
+			setLog("Error opening folder: " + err.Error())
+			return
+		}
+		if dst == nil {
+			return
+		}
+		if err := archive.Extract(dst.Path()); err != nil {
+			setLog("Failed to restore archive: " + errorText(err))
+			return
+		}
+		setLog(fmt.Sprintf("From user %d: %d entries restored to %s", file.Header.Sender, len(archive.Entries), dst.Path()))
+	}, myWindow)
+}
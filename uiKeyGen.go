@@ -0,0 +1,104 @@
+package main
+
+import (
+	"QalqanDS/qalqan"
+	"fmt"
+	"os"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+func showKeyGenDialog(myWindow fyne.Window, logs *widget.RichText) {
+	usersEntry := widget.NewEntry()
+	usersEntry.SetText("1")
+	usersEntry.Validator = func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > qalqan.MaxKeySetUsers {
+			return fmt.Errorf("enter a number from 1 to %d", qalqan.MaxKeySetUsers)
+		}
+		return nil
+	}
+
+	keyLenSelect := widget.NewSelect([]string{"32", "48", "64", "80", "96", "112", "128"}, nil)
+	keyLenSelect.SetSelected(strconv.Itoa(qalqan.DEFAULT_KEY_LEN))
+
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Users", usersEntry),
+		widget.NewFormItem("Key length", keyLenSelect),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+	}
+
+	dialog.ShowForm("New key set", "Generate", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		users, _ := strconv.Atoi(usersEntry.Text)
+		klen, _ := strconv.Atoi(keyLenSelect.Selected)
+		password := passwordEntry.Text
+		if password == "" {
+			dialog.ShowInformation("Error", "Enter a password!", myWindow)
+			return
+		}
+		if password != confirmEntry.Text {
+			dialog.ShowInformation("Error", "Passwords do not match!", myWindow)
+			return
+		}
+
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: "Error saving file: " + err.Error(), Style: widget.RichTextStyleInline}}
+				logs.Refresh()
+				return
+			}
+			if writer == nil {
+				return
+			}
+			err = qalqan.GenerateKeySet(writer, password, klen, users)
+			if cerr := writer.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				storage.Delete(writer.URI())
+				logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: "Key generation failed: " + err.Error(), Style: widget.RichTextStyleInline}}
+				logs.Refresh()
+				return
+			}
+			if err := createKeyLedger(writer.URI().Path(), password); err != nil {
+				logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: "Keys saved, but the key usage record could not be created: " + errorText(err), Style: widget.RichTextStyleInline}}
+				logs.Refresh()
+				return
+			}
+			logs.Segments = []widget.RichTextSegment{&widget.TextSegment{Text: fmt.Sprintf("Key set for %d users saved: %s", users, writer.URI().Name()), Style: widget.RichTextStyleInline}}
+			logs.Refresh()
+			dialog.ShowInformation("Success", "Keys generated successfully!", myWindow)
+		}, myWindow)
+		saveDialog.SetFileName("keys.bin")
+		saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".bin"}))
+		saveDialog.Show()
+	}, myWindow)
+}
+
+// createKeyLedger unlocks the key file just written to path and starts its
+// empty ledger, so that loading it later does not ask for a reset.
+func createKeyLedger(path, password string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	ks, err := qalqan.LoadKeySet(f, password)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	defer ks.Wipe()
+	_, err = qalqan.CreateLedger(qalqan.LedgerPath(path), ks)
+	return err
+}